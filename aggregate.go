@@ -0,0 +1,68 @@
+package mongokit
+
+import (
+	"context"
+	"github.com/dinson/mongokit/querybuilder"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (r repositoryImpl[T]) Aggregate(ctx context.Context, query *querybuilder.Query) ([]*T, error) {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	cursor, err := r.aggregateCursor(newCtx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDecrypted[T](newCtx, r.config.keys, cursor)
+}
+
+/*
+		AggregateAs runs the aggregation pipeline of the query and decodes the results into R,
+		for pipelines whose output does not have the shape of the model of the repository.
+
+	 	Example usage:
+
+		type CountryCount struct {
+			Country string `bson:"_id"`
+			Users   int    `bson:"users"`
+		}
+
+		query, _ := querybuilder.New().
+			EqualString("status", "active").
+			IncludeFilters().
+			Group(querybuilder.Ref("country"), querybuilder.Sum("users", 1)).
+			Aggregate()
+		counts, err := AggregateAs[CountryCount](ctx, usersRepo, query)
+*/
+func AggregateAs[R any, T any](ctx context.Context, repo Repository[T], query *querybuilder.Query) ([]*R, error) {
+	finder, ok := repo.(cursorFinder)
+	if !ok {
+		return nil, errUnsupportedRepository
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	cursor, err := finder.aggregateCursor(newCtx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDecrypted[R](newCtx, finder.keyProvider(), cursor)
+}
+
+func (r repositoryImpl[T]) aggregateCursor(ctx context.Context, query *querybuilder.Query) (*mongo.Cursor, error) {
+	query, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return collection.Aggregate(ctx, query.Aggregate)
+}
@@ -0,0 +1,626 @@
+package mongokit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dinson/mongokit/querybuilder"
+	"github.com/dinson/mongokit/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type AuditOperation string
+
+const (
+	AuditInsert AuditOperation = "insert"
+	AuditUpdate AuditOperation = "update"
+	AuditDelete AuditOperation = "delete"
+)
+
+// AuditRecord is a single change of a document, as stored in the history collection
+type AuditRecord struct {
+	DocumentID any            `bson:"documentId"`
+	Operation  AuditOperation `bson:"operation"`
+	Actor      string         `bson:"actor,omitempty"`
+	// Before and After are the snapshots of the document, stored unless AuditOptions.DiffOnly is set
+	Before bson.Raw `bson:"before,omitempty"`
+	After  bson.Raw `bson:"after,omitempty"`
+	// Changes lists the changed fields, stored when AuditOptions.DiffOnly is set
+	Changes   []FieldChange `bson:"changes,omitempty"`
+	Timestamp time.Time     `bson:"timestamp"`
+}
+
+// FieldChange is the change of a single field, with nested fields in dot notation.
+// Before is nil for added fields and After is nil for removed fields.
+type FieldChange struct {
+	Field  string `bson:"field"`
+	Before any    `bson:"before,omitempty"`
+	After  any    `bson:"after,omitempty"`
+}
+
+type AuditOptions struct {
+	// DiffOnly stores the changed fields of each write instead of full before and after snapshots
+	DiffOnly bool
+	// Actor returns who performs a write. Defaults to the actor set with WithActor.
+	Actor func(ctx context.Context) string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose writes are attributed to actor in the audit trail
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor, or an empty string
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+type AuditedRepository[T any] interface {
+	Repository[T]
+
+	// History returns the audit records of the document with the given _id, oldest first.
+	History(ctx context.Context, id any) ([]*AuditRecord, error)
+}
+
+type auditedRepository[T any] struct {
+	Repository[T]
+	history *mongo.Collection
+	opts    AuditOptions
+}
+
+/*
+		NewAuditedRepository wraps repo so that every Save, insert, update and delete writes
+		a history record to the history collection: who changed which document, how and when.
+
+		Records are written after the change succeeded. To store the change and its record atomically,
+		run the write inside a transaction, e.g. with outbox.Transaction, the record is written
+		with the same context.
+
+	 	Example usage:
+
+		usersRepo := NewAuditedRepository(NewRepository[User](db.Collection("users")), db.Collection("users_history"), nil)
+
+		_, err := usersRepo.Save(WithActor(ctx, "admin@example.com"), user, nil)
+
+		records, err := usersRepo.History(ctx, user.ID)
+*/
+func NewAuditedRepository[T any](repo Repository[T], history *mongo.Collection, opts *AuditOptions) AuditedRepository[T] {
+	a := &auditedRepository[T]{
+		Repository: repo,
+		history:    history,
+	}
+	if opts != nil {
+		a.opts = *opts
+	}
+	if a.opts.Actor == nil {
+		a.opts.Actor = ActorFromContext
+	}
+
+	return a
+}
+
+func (a auditedRepository[T]) Save(ctx context.Context, entity *T, ID *string) (*primitive.ObjectID, error) {
+	return a.saveScoped(ctx, entity, ID, nil)
+}
+
+func (a auditedRepository[T]) saveScoped(ctx context.Context, entity *T, ID *string, scope bson.D) (*primitive.ObjectID, error) {
+	save := a.Repository.Save
+	if scope != nil {
+		saver, ok := a.Repository.(scopedSaver[T])
+		if !ok {
+			return nil, errUnsupportedRepository
+		}
+		save = func(ctx context.Context, entity *T, ID *string) (*primitive.ObjectID, error) {
+			return saver.saveScoped(ctx, entity, ID, scope)
+		}
+	}
+
+	var ids []any
+	if ID != nil {
+		oID, err := utils.StringToObjectID(*ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, *oID)
+	}
+
+	before, err := a.snapshots(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	oid, err := save(ctx, entity, ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return oid, a.recordChanges(ctx, before, []any{*oid})
+}
+
+// InsertMany inserts docs like the wrapped repository, through InsertManyChunked so that
+// every inserted document is recorded by its input index
+func (a auditedRepository[T]) InsertMany(ctx context.Context, docs []*T) ([]*primitive.ObjectID, error) {
+	result, err := a.InsertManyChunked(ctx, docs, &InsertManyOptions{Ordered: true})
+	if result == nil {
+		return nil, err
+	}
+
+	return insertedObjectIDs(result, err)
+}
+
+func (a auditedRepository[T]) InsertManyChunked(ctx context.Context, docs []*T, opts *InsertManyOptions) (*InsertManyResult, error) {
+	result, err := a.Repository.InsertManyChunked(ctx, docs, opts)
+	if result == nil {
+		return result, err
+	}
+
+	if auditErr := a.recordInserts(ctx, docs, result); auditErr != nil {
+		return result, errors.Join(err, auditErr)
+	}
+
+	return result, err
+}
+
+func (a auditedRepository[T]) BulkWrite(ctx context.Context, ops []WriteModel[T], opts *BulkWriteOptions) (*BulkWriteResult, error) {
+	var ids []any
+	for _, op := range ops {
+		if op.query == nil {
+			continue
+		}
+
+		// every matching document is read, the documents left unchanged are not recorded
+		matched, err := a.matchingIDs(ctx, &querybuilder.Query{
+			Filters:      op.query.Filters,
+			RawQuery:     op.query.RawQuery,
+			BatchFilters: op.query.BatchFilters,
+		}, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, matched...)
+	}
+
+	before, err := a.snapshots(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := a.Repository.BulkWrite(ctx, ops, opts)
+	if result == nil {
+		return result, err
+	}
+
+	for _, id := range result.InsertedIDs {
+		ids = append(ids, id)
+	}
+	for _, id := range result.UpsertedIDs {
+		ids = append(ids, id)
+	}
+
+	if auditErr := a.recordChanges(ctx, before, ids); auditErr != nil {
+		return result, errors.Join(err, auditErr)
+	}
+
+	return result, err
+}
+
+// DeleteOne deletes the first document matching the query and records it. The document is looked up first,
+// then deleted by the query restricted to its _id, so that the recorded document is the deleted one.
+func (a auditedRepository[T]) DeleteOne(ctx context.Context, query *querybuilder.Query) error {
+	if query == nil {
+		return a.Repository.DeleteOne(ctx, query)
+	}
+
+	// deletes only match on Filters
+	ids, err := a.matchingIDs(ctx, &querybuilder.Query{Filters: query.Filters}, 1)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return a.Repository.DeleteOne(ctx, query)
+	}
+
+	byID := *query
+	byID.Filters = append(append([]bson.D{}, query.Filters...), bson.D{{"_id", ids[0]}})
+
+	return a.delete(ctx, &byID, ids, a.Repository.DeleteOne)
+}
+
+// DeleteMany deletes like the wrapped repository and records the documents that were deleted
+func (a auditedRepository[T]) DeleteMany(ctx context.Context, query *querybuilder.Query) error {
+	var ids []any
+	if query != nil {
+		matched, err := a.matchingIDs(ctx, &querybuilder.Query{Filters: query.Filters}, 0)
+		if err != nil {
+			return err
+		}
+		ids = matched
+	}
+
+	return a.delete(ctx, query, ids, a.Repository.DeleteMany)
+}
+
+// delete runs deleteFn and records which of the documents ids were deleted
+func (a auditedRepository[T]) delete(ctx context.Context, query *querybuilder.Query, ids []any, deleteFn func(ctx context.Context, query *querybuilder.Query) error) error {
+	before, err := a.snapshots(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	if err = deleteFn(ctx, query); err != nil {
+		return err
+	}
+
+	return a.recordChanges(ctx, before, ids)
+}
+
+func (a auditedRepository[T]) History(ctx context.Context, id any) ([]*AuditRecord, error) {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{"timestamp", 1}, {"_id", 1}})
+
+	cursor, err := a.history.Find(newCtx, bson.D{{"documentId", id}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeAll[AuditRecord](newCtx, cursor)
+}
+
+// EnsureIndexes creates the index of the history collection used by History, then the indexes of T
+func (a auditedRepository[T]) EnsureIndexes(ctx context.Context) error {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	_, err := a.history.Indexes().CreateOne(newCtx, mongo.IndexModel{
+		Keys: bson.D{{"documentId", 1}, {"timestamp", 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.Repository.EnsureIndexes(ctx)
+}
+
+func (a auditedRepository[T]) findCursor(ctx context.Context, query *querybuilder.Query) (*mongo.Cursor, error) {
+	finder, ok := a.Repository.(cursorFinder)
+	if !ok {
+		return nil, errUnsupportedRepository
+	}
+	return finder.findCursor(ctx, query)
+}
+
+func (a auditedRepository[T]) aggregateCursor(ctx context.Context, query *querybuilder.Query) (*mongo.Cursor, error) {
+	finder, ok := a.Repository.(cursorFinder)
+	if !ok {
+		return nil, errUnsupportedRepository
+	}
+	return finder.aggregateCursor(ctx, query)
+}
+
+func (a auditedRepository[T]) autoPopulates() bool {
+	p, ok := a.Repository.(autoPopulater)
+	return ok && p.autoPopulates()
+}
+
+func (a auditedRepository[T]) keyProvider() KeyProvider {
+	if finder, ok := a.Repository.(cursorFinder); ok {
+		return finder.keyProvider()
+	}
+	return nil
+}
+
+// matchingIDs returns the _id of the documents matching the filters of the query, at most limit of them
+// unless limit is 0. The options of the query are not used, only the _id of the documents is read.
+func (a auditedRepository[T]) matchingIDs(ctx context.Context, query *querybuilder.Query, limit int64) ([]any, error) {
+	query.Options = options.Find().SetProjection(bson.D{{"_id", 1}})
+	if limit > 0 {
+		query.Options.SetLimit(limit)
+	}
+
+	docs, err := a.Repository.FindAll(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]any, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		if value, err := bson.Raw(raw).LookupErr("_id"); err == nil {
+			var id any
+			if err = value.Unmarshal(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// snapshots reads the current state of the documents with the given ids, keyed by rawKey of their _id
+func (a auditedRepository[T]) snapshots(ctx context.Context, ids []any) (map[string]bson.Raw, error) {
+	resp := map[string]bson.Raw{}
+	if len(ids) == 0 {
+		return resp, nil
+	}
+
+	query, err := querybuilder.New().MatchAny("_id", ids).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := a.Repository.FindAll(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		value, err := bson.Raw(raw).LookupErr("_id")
+		if err != nil {
+			continue
+		}
+		resp[rawKey(value)] = raw
+	}
+
+	return resp, nil
+}
+
+// recordChanges compares the documents before a write with their current state and records what changed
+func (a auditedRepository[T]) recordChanges(ctx context.Context, before map[string]bson.Raw, ids []any) error {
+	after, err := a.snapshots(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var records []*AuditRecord
+	seen := map[string]bool{}
+
+	for _, id := range ids {
+		key, ok := valueKey(id)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		oldDoc, existed := before[key]
+		newDoc, exists := after[key]
+
+		switch {
+		case !existed && exists:
+			records = append(records, a.record(ctx, AuditInsert, id, nil, newDoc))
+		case existed && !exists:
+			records = append(records, a.record(ctx, AuditDelete, id, oldDoc, nil))
+		case existed && exists && !bytes.Equal(oldDoc, newDoc):
+			records = append(records, a.record(ctx, AuditUpdate, id, oldDoc, newDoc))
+		}
+	}
+
+	return a.write(ctx, records)
+}
+
+// recordInserts records the inserted documents of an insert result
+func (a auditedRepository[T]) recordInserts(ctx context.Context, docs []*T, result *InsertManyResult) error {
+	records, err := a.insertRecords(ctx, docs, result)
+	if err != nil {
+		return err
+	}
+
+	return a.write(ctx, records)
+}
+
+// insertRecords returns the records of the inserted documents, InsertedIDs holds their _id at their input index
+func (a auditedRepository[T]) insertRecords(ctx context.Context, docs []*T, result *InsertManyResult) ([]*AuditRecord, error) {
+	records := make([]*AuditRecord, 0, len(result.InsertedIDs))
+
+	for i, id := range result.InsertedIDs {
+		if id == nil || i >= len(docs) {
+			continue
+		}
+
+		raw, err := bson.Marshal(docs[i])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, a.record(ctx, AuditInsert, id, nil, raw))
+	}
+
+	return records, nil
+}
+
+func (a auditedRepository[T]) record(ctx context.Context, operation AuditOperation, id any, before, after bson.Raw) *AuditRecord {
+	record := &AuditRecord{
+		DocumentID: id,
+		Operation:  operation,
+		Actor:      a.opts.Actor(ctx),
+		Timestamp:  time.Now().UTC(),
+	}
+
+	if a.opts.DiffOnly {
+		record.Changes = diffDocuments("", before, after, nil)
+	} else {
+		record.Before = before
+		record.After = after
+	}
+
+	return record
+}
+
+func (a auditedRepository[T]) write(ctx context.Context, records []*AuditRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	docs := make([]any, 0, len(records))
+	for _, record := range records {
+		if err := a.protect(ctx, record); err != nil {
+			return err
+		}
+		docs = append(docs, record)
+	}
+
+	if _, err := a.history.InsertMany(newCtx, docs); err != nil {
+		return fmt.Errorf("%w: %v", errAuditFailed, err)
+	}
+
+	return nil
+}
+
+// protect encrypts the values of the encrypted fields of T in a record, see WithEncryption,
+// so that the history does not keep them in plaintext.
+func (a auditedRepository[T]) protect(ctx context.Context, record *AuditRecord) error {
+	keys := a.keyProvider()
+	if keys == nil {
+		return nil
+	}
+
+	fields, err := encryptedFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+
+	if record.Before, err = encryptRaw[T](ctx, keys, record.Before); err != nil {
+		return err
+	}
+	if record.After, err = encryptRaw[T](ctx, keys, record.After); err != nil {
+		return err
+	}
+
+	c := newFieldCipher(ctx, keys)
+	for i, change := range record.Changes {
+		for _, f := range fields {
+			var rest []string
+			if f.path != change.Field {
+				if !strings.HasPrefix(f.path, change.Field+".") {
+					continue
+				}
+				rest = strings.Split(strings.TrimPrefix(f.path, change.Field+"."), ".")
+			}
+
+			if record.Changes[i].Before, err = encryptAt(c, f, change.Before, rest); err != nil {
+				return err
+			}
+			if record.Changes[i].After, err = encryptAt(c, f, change.After, rest); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// encryptRaw encrypts the encrypted fields of a document of T
+func encryptRaw[T any](ctx context.Context, keys KeyProvider, raw bson.Raw) (bson.Raw, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var doc T
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryptDoc(ctx, keys, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.Marshal(encrypted)
+}
+
+// encryptAt encrypts the string at the path rest of a changed value, the value itself when rest is empty
+func encryptAt(c *fieldCipher, f encryptedField, value any, rest []string) (any, error) {
+	if len(rest) == 0 {
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		return c.encrypt(f.path, s, f.deterministic)
+	}
+
+	doc, ok := value.(bson.D)
+	if !ok {
+		return value, nil
+	}
+
+	resp := make(bson.D, len(doc))
+	copy(resp, doc)
+	for i, e := range resp {
+		if e.Key != rest[0] {
+			continue
+		}
+		encrypted, err := encryptAt(c, f, e.Value, rest[1:])
+		if err != nil {
+			return nil, err
+		}
+		resp[i].Value = encrypted
+	}
+
+	return resp, nil
+}
+
+// diffDocuments appends the fields that differ between before and after, descending into embedded documents.
+// Arrays are compared as a whole.
+func diffDocuments(prefix string, before, after bson.Raw, changes []FieldChange) []FieldChange {
+	beforeElems, _ := before.Elements()
+	afterElems, _ := after.Elements()
+
+	afterValues := make(map[string]bson.RawValue, len(afterElems))
+	for _, elem := range afterElems {
+		afterValues[elem.Key()] = elem.Value()
+	}
+
+	beforeKeys := make(map[string]bool, len(beforeElems))
+	for _, elem := range beforeElems {
+		key := elem.Key()
+		beforeKeys[key] = true
+		oldValue := elem.Value()
+		newValue, ok := afterValues[key]
+
+		switch {
+		case !ok:
+			changes = append(changes, FieldChange{Field: prefix + key, Before: rawValue(oldValue)})
+		case oldValue.Type == bson.TypeEmbeddedDocument && newValue.Type == bson.TypeEmbeddedDocument:
+			changes = diffDocuments(prefix+key+".", oldValue.Document(), newValue.Document(), changes)
+		case !oldValue.Equal(newValue):
+			changes = append(changes, FieldChange{Field: prefix + key, Before: rawValue(oldValue), After: rawValue(newValue)})
+		}
+	}
+
+	for _, elem := range afterElems {
+		if !beforeKeys[elem.Key()] {
+			changes = append(changes, FieldChange{Field: prefix + elem.Key(), After: rawValue(elem.Value())})
+		}
+	}
+
+	return changes
+}
+
+func rawValue(value bson.RawValue) any {
+	var v any
+	if err := value.Unmarshal(&v); err != nil {
+		return nil
+	}
+	return v
+}
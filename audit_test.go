@@ -0,0 +1,80 @@
+package mongokit
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+type auditedDoc struct {
+	ID   any    `bson:"_id,omitempty"`
+	Name string `bson:"name"`
+}
+
+func TestAuditInsertRecordsByInputIndex(t *testing.T) {
+	oid := primitive.NewObjectID()
+	docs := []*auditedDoc{
+		{Name: "failed"},
+		{ID: "custom", Name: "string id"},
+		{Name: "object id"},
+		{Name: "not attempted"},
+	}
+	docs[2].ID = oid
+
+	result := &InsertManyResult{
+		InsertedIDs: []any{nil, "custom", oid, nil},
+		Failures:    map[int]error{0: errors.New("duplicate key"), 3: errNotAttempted},
+	}
+
+	a := auditedRepository[auditedDoc]{opts: AuditOptions{Actor: ActorFromContext}}
+
+	records, err := a.insertRecords(WithActor(context.Background(), "importer"), docs, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	for i, want := range []struct {
+		id   any
+		name string
+	}{{"custom", "string id"}, {oid, "object id"}} {
+		record := records[i]
+		if record.DocumentID != want.id {
+			t.Errorf("record %d: document id %v, want %v", i, record.DocumentID, want.id)
+		}
+		if record.Operation != AuditInsert || record.Actor != "importer" || record.Before != nil {
+			t.Errorf("record %d: got %+v", i, record)
+		}
+
+		var after auditedDoc
+		if err = bson.Unmarshal(record.After, &after); err != nil {
+			t.Fatal(err)
+		}
+		if after.Name != want.name {
+			t.Errorf("record %d: snapshot of %q, want %q", i, after.Name, want.name)
+		}
+	}
+}
+
+func TestInsertedObjectIDsSkipsDocumentsNotInserted(t *testing.T) {
+	oid := primitive.NewObjectID()
+	result := &InsertManyResult{InsertedIDs: []any{nil, oid, nil}}
+
+	ids, err := insertedObjectIDs(result, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || *ids[0] != oid {
+		t.Fatalf("got %v, want [%v]", ids, oid)
+	}
+
+	var nonObjectIDs *NonObjectIDError
+	_, err = insertedObjectIDs(&InsertManyResult{InsertedIDs: []any{"custom", oid}}, nil)
+	if !errors.As(err, &nonObjectIDs) {
+		t.Fatalf("got %v, want a NonObjectIDError", err)
+	}
+}
@@ -0,0 +1,215 @@
+package mongokit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dinson/mongokit/querybuilder"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type writeKind int
+
+const (
+	writeInsertOne writeKind = iota
+	writeUpdateOne
+	writeUpdateMany
+	writeReplaceOne
+	writeDeleteOne
+	writeDeleteMany
+)
+
+// WriteModel is a single operation of a BulkWrite, created with
+// InsertOneModel, UpdateOneModel, UpdateManyModel, ReplaceOneModel, DeleteOneModel or DeleteManyModel.
+type WriteModel[T any] struct {
+	kind   writeKind
+	doc    *T
+	query  *querybuilder.Query
+	upsert bool
+}
+
+// InsertOneModel inserts doc
+func InsertOneModel[T any](doc *T) WriteModel[T] {
+	return WriteModel[T]{kind: writeInsertOne, doc: doc}
+}
+
+// UpdateOneModel sets the fields of doc on the first document matching the query, the same way Save does
+func UpdateOneModel[T any](query *querybuilder.Query, doc *T, upsert bool) WriteModel[T] {
+	return WriteModel[T]{kind: writeUpdateOne, doc: doc, query: query, upsert: upsert}
+}
+
+// UpdateManyModel sets the fields of doc on every document matching the query
+func UpdateManyModel[T any](query *querybuilder.Query, doc *T, upsert bool) WriteModel[T] {
+	return WriteModel[T]{kind: writeUpdateMany, doc: doc, query: query, upsert: upsert}
+}
+
+// ReplaceOneModel replaces the first document matching the query with doc
+func ReplaceOneModel[T any](query *querybuilder.Query, doc *T, upsert bool) WriteModel[T] {
+	return WriteModel[T]{kind: writeReplaceOne, doc: doc, query: query, upsert: upsert}
+}
+
+// DeleteOneModel deletes the first document matching the query
+func DeleteOneModel[T any](query *querybuilder.Query) WriteModel[T] {
+	return WriteModel[T]{kind: writeDeleteOne, query: query}
+}
+
+// DeleteManyModel deletes every document matching the query
+func DeleteManyModel[T any](query *querybuilder.Query) WriteModel[T] {
+	return WriteModel[T]{kind: writeDeleteMany, query: query}
+}
+
+type BulkWriteOptions struct {
+	// Ordered stops at the first failed operation. When false, every operation is attempted
+	// and failures are reported individually. BulkWrite is ordered when no options are passed.
+	Ordered bool
+}
+
+type BulkWriteResult struct {
+	InsertedCount int64
+	MatchedCount  int64
+	ModifiedCount int64
+	DeletedCount  int64
+	UpsertedCount int64
+	// InsertedIDs maps the index of each successful insert operation to the _id of the inserted document
+	InsertedIDs map[int]any
+	// UpsertedIDs maps the index of each update or replace operation that inserted a document to its _id
+	UpsertedIDs map[int]any
+	// Errors maps the index of each failed operation to its error
+	Errors map[int]*WriteError
+}
+
+// WriteError is the failure of a single operation of a batch
+type WriteError struct {
+	Index   int
+	Code    int
+	Message string
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("operation %d failed with code %d: %s", e.Index, e.Code, e.Message)
+}
+
+func (r repositoryImpl[T]) BulkWrite(ctx context.Context, ops []WriteModel[T], opts *BulkWriteOptions) (*BulkWriteResult, error) {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	models := make([]mongo.WriteModel, 0, len(ops))
+	insertedIDs := map[int]any{}
+
+	for i, op := range ops {
+		if op.query != nil {
+			query, err := r.prepare(newCtx, op.query)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			op.query = query
+		}
+
+		if op.doc != nil {
+			encrypted, err := encryptDoc(newCtx, r.config.keys, op.doc)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			op.doc = encrypted
+		}
+
+		model, id, err := op.writeModel()
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		if op.kind == writeInsertOne {
+			insertedIDs[i] = id
+		}
+
+		models = append(models, model)
+	}
+
+	ordered := opts == nil || opts.Ordered
+
+	collection, err := r.resolve(newCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := collection.BulkWrite(newCtx, models, options.BulkWrite().SetOrdered(ordered))
+
+	resp := &BulkWriteResult{
+		InsertedIDs: map[int]any{},
+		UpsertedIDs: map[int]any{},
+		Errors:      map[int]*WriteError{},
+	}
+	if res != nil {
+		resp.InsertedCount = res.InsertedCount
+		resp.MatchedCount = res.MatchedCount
+		resp.ModifiedCount = res.ModifiedCount
+		resp.DeletedCount = res.DeletedCount
+		resp.UpsertedCount = res.UpsertedCount
+		for i, id := range res.UpsertedIDs {
+			resp.UpsertedIDs[int(i)] = id
+		}
+	}
+
+	var exception mongo.BulkWriteException
+	if err != nil && !errors.As(err, &exception) {
+		// the outcome of the operations is unknown
+		return resp, err
+	}
+
+	failedAt := len(ops)
+	for _, we := range exception.WriteErrors {
+		resp.Errors[we.Index] = &WriteError{Index: we.Index, Code: we.Code, Message: we.Message}
+		if we.Index < failedAt {
+			failedAt = we.Index
+		}
+	}
+
+	for i, id := range insertedIDs {
+		if _, failed := resp.Errors[i]; failed || (ordered && i > failedAt) {
+			continue
+		}
+		resp.InsertedIDs[i] = id
+		// only documents that were inserted get their generated id
+		setID(ops[i].doc, id)
+	}
+
+	if exception.WriteConcernError != nil {
+		return resp, err
+	}
+	if len(resp.Errors) > 0 {
+		return resp, fmt.Errorf("%w: %d of %d operations failed", errBulkWriteFailed, len(resp.Errors), len(ops))
+	}
+
+	return resp, nil
+}
+
+// writeModel converts the operation into a driver write model.
+// For inserts, it also returns the _id of the document, generated when missing.
+func (op WriteModel[T]) writeModel() (mongo.WriteModel, any, error) {
+	var filter any
+	if op.query != nil {
+		filter = op.query.GetFilter()
+	}
+
+	switch op.kind {
+	case writeInsertOne:
+		raw, id, err := marshalWithID(op.doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		return mongo.NewInsertOneModel().SetDocument(raw), id, nil
+	case writeUpdateOne:
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.D{{"$set", op.doc}}).SetUpsert(op.upsert), nil, nil
+	case writeUpdateMany:
+		return mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(bson.D{{"$set", op.doc}}).SetUpsert(op.upsert), nil, nil
+	case writeReplaceOne:
+		return mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(op.doc).SetUpsert(op.upsert), nil, nil
+	case writeDeleteOne:
+		return mongo.NewDeleteOneModel().SetFilter(filter), nil, nil
+	case writeDeleteMany:
+		return mongo.NewDeleteManyModel().SetFilter(filter), nil, nil
+	}
+
+	return nil, nil, errInvalidWriteModel
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// key is a single generated constant
+type key struct {
+	name string // Go identifier suffix, e.g. AddressCity
+	path string // bson field path, e.g. address.city
+}
+
+type generator struct {
+	pkgName string
+	structs map[string]*ast.StructType
+	order   []string // struct names in declaration order
+}
+
+func newGenerator(dir, outputFile string) (*generator, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		structs: map[string]*ast.StructType{},
+	}
+	fset := token.NewFileSet()
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == outputFile {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+
+		if g.pkgName == "" {
+			g.pkgName = file.Name.Name
+		}
+
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					g.structs[ts.Name.Name] = st
+					g.order = append(g.order, ts.Name.Name)
+				}
+			}
+		}
+	}
+
+	if g.pkgName == "" {
+		return nil, fmt.Errorf("no go files found in %s", dir)
+	}
+
+	return g, nil
+}
+
+func (g *generator) generate(types []string) ([]byte, error) {
+	if len(types) == 0 {
+		for _, name := range g.order {
+			if ast.IsExported(name) && hasBSONTags(g.structs[name]) {
+				types = append(types, name)
+			}
+		}
+		if len(types) == 0 {
+			return nil, fmt.Errorf("no structs with bson tags found in package %s", g.pkgName)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by mongokit-keys; DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", g.pkgName)
+	fmt.Fprintf(buf, "import \"github.com/dinson/mongokit/querybuilder\"\n")
+
+	for _, typeName := range types {
+		st, ok := g.structs[typeName]
+		if !ok {
+			return nil, fmt.Errorf("struct %s not found in package %s", typeName, g.pkgName)
+		}
+
+		var keys []key
+		g.walk(st, "", "", map[string]bool{typeName: true}, &keys)
+
+		if err := checkDuplicates(typeName, keys); err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(buf, "\n// %s field keys\nconst (\n", typeName)
+		for _, k := range keys {
+			fmt.Fprintf(buf, "\t%sKey%s querybuilder.KeyMongoDB = %s\n", typeName, k.name, strconv.Quote(k.path))
+		}
+		fmt.Fprintf(buf, ")\n")
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// walk collects the keys of every encoded field of the struct, descending into
+// nested structs declared in the same package.
+// visiting guards against recursive types such as trees.
+func (g *generator) walk(st *ast.StructType, pathPrefix, namePrefix string, visiting map[string]bool, keys *[]key) {
+	for _, field := range st.Fields.List {
+		tag := ""
+		if field.Tag != nil {
+			tag, _ = strconv.Unquote(field.Tag.Value)
+		}
+		bsonName, inline, skip := parseTag(reflect.StructTag(tag).Get("bson"))
+		if skip {
+			continue
+		}
+
+		goNames := make([]string, 0, len(field.Names))
+		for _, n := range field.Names {
+			goNames = append(goNames, n.Name)
+		}
+		if len(goNames) == 0 {
+			goNames = append(goNames, embeddedName(field.Type))
+		}
+
+		for _, goName := range goNames {
+			if !ast.IsExported(goName) {
+				continue
+			}
+
+			nested, nestedName := g.resolveStruct(field.Type)
+
+			if inline && nested != nil {
+				if !visiting[nestedName] {
+					visiting[nestedName] = true
+					g.walk(nested, pathPrefix, namePrefix, visiting, keys)
+					delete(visiting, nestedName)
+				}
+				continue
+			}
+
+			name := bsonName
+			if name == "" {
+				// the driver lowercases the field name when no bson name is given
+				name = strings.ToLower(goName)
+			}
+
+			path := pathPrefix + name
+			constName := namePrefix + goName
+			*keys = append(*keys, key{name: constName, path: path})
+
+			if nested != nil && !visiting[nestedName] {
+				visiting[nestedName] = true
+				g.walk(nested, path+".", constName, visiting, keys)
+				delete(visiting, nestedName)
+			}
+		}
+	}
+}
+
+// resolveStruct returns the struct type behind pointers, slices and arrays,
+// when it is declared in the same package or inline.
+func (g *generator) resolveStruct(expr ast.Expr) (*ast.StructType, string) {
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ArrayType:
+			expr = t.Elt
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.Ident:
+			return g.structs[t.Name], t.Name
+		case *ast.StructType:
+			return t, ""
+		default:
+			// maps, interfaces and types from other packages are leaves
+			return nil, ""
+		}
+	}
+}
+
+func embeddedName(expr ast.Expr) string {
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.SelectorExpr:
+			return t.Sel.Name
+		case *ast.Ident:
+			return t.Name
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		default:
+			return ""
+		}
+	}
+}
+
+// parseTag reads a bson struct tag such as `name,omitempty` or `,inline`
+func parseTag(tag string) (name string, inline, skip bool) {
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			inline = true
+		}
+	}
+
+	return name, inline, false
+}
+
+func hasBSONTags(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tag, _ := strconv.Unquote(field.Tag.Value)
+		if _, ok := reflect.StructTag(tag).Lookup("bson"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func checkDuplicates(typeName string, keys []key) error {
+	seen := map[string]string{}
+	var duplicates []string
+
+	for _, k := range keys {
+		if path, ok := seen[k.name]; ok && path != k.path {
+			duplicates = append(duplicates, fmt.Sprintf("%sKey%s (%q, %q)", typeName, k.name, path, k.path))
+		}
+		seen[k.name] = k.path
+	}
+
+	if len(duplicates) > 0 {
+		sort.Strings(duplicates)
+		return fmt.Errorf("conflicting constant names: %s", strings.Join(duplicates, ", "))
+	}
+
+	return nil
+}
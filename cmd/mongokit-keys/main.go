@@ -0,0 +1,81 @@
+/*
+Command mongokit-keys generates typed querybuilder.KeyMongoDB constants from model structs,
+so that filters reference compile-checked field names instead of string literals.
+
+Field names follow the bson tags of the model, the same way the mongo driver encodes them.
+Nested structs declared in the same package produce dotted paths ("address.city"),
+and slices of structs produce array paths ("items.sku").
+
+	Example usage:
+
+	//go:generate go run github.com/dinson/mongokit/cmd/mongokit-keys -type=User,Order
+
+	type User struct {
+		ID      *primitive.ObjectID `bson:"_id,omitempty"`
+		Address Address             `bson:"address"`
+	}
+
+generates
+
+	const (
+		UserKeyID          querybuilder.KeyMongoDB = "_id"
+		UserKeyAddress     querybuilder.KeyMongoDB = "address"
+		UserKeyAddressCity querybuilder.KeyMongoDB = "address.city"
+	)
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mongokit-keys: ")
+
+	typeNames := flag.String("type", "", "comma-separated list of model struct names; defaults to every struct with bson tags")
+	output := flag.String("output", "", "output file name; defaults to mongokit_keys.go in the package directory")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: mongokit-keys [flags] [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	outputPath := *output
+	if outputPath == "" {
+		outputPath = filepath.Join(dir, "mongokit_keys.go")
+	}
+
+	var types []string
+	if *typeNames != "" {
+		for _, t := range strings.Split(*typeNames, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+
+	g, err := newGenerator(dir, filepath.Base(outputPath))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := g.generate(types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = os.WriteFile(outputPath, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
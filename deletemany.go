@@ -10,9 +10,19 @@ func (r repositoryImpl[T]) DeleteMany(ctx context.Context, query *querybuilder.Q
 	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
 	defer cancel()
 
+	query, err := r.prepare(newCtx, query)
+	if err != nil {
+		return err
+	}
+
+	collection, err := r.resolve(newCtx)
+	if err != nil {
+		return err
+	}
+
 	filters := bson.D{{"$and", query.Filters}}
 
-	_, err := r.collection.DeleteMany(newCtx, filters)
+	_, err = collection.DeleteMany(newCtx, filters)
 	if err != nil {
 		return err
 	}
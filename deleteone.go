@@ -10,9 +10,19 @@ func (r repositoryImpl[T]) DeleteOne(ctx context.Context, query *querybuilder.Qu
 	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
 	defer cancel()
 
+	query, err := r.prepare(newCtx, query)
+	if err != nil {
+		return err
+	}
+
+	collection, err := r.resolve(newCtx)
+	if err != nil {
+		return err
+	}
+
 	filters := bson.D{{"$and", query.Filters}}
 
-	_, err := r.collection.DeleteOne(newCtx, filters)
+	_, err = collection.DeleteOne(newCtx, filters)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,71 @@
+package mongokit
+
+import (
+	"context"
+	"github.com/dinson/mongokit/querybuilder"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (r repositoryImpl[T]) Distinct(ctx context.Context, key querybuilder.KeyMongoDB, query *querybuilder.Query) ([]any, error) {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	var filter any = bson.D{}
+	if query != nil {
+		prepared, err := r.prepare(newCtx, query)
+		if err != nil {
+			return nil, err
+		}
+		filter = prepared.GetFilter()
+	}
+
+	collection, err := r.resolve(newCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := collection.Distinct(newCtx, key.String(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = decryptValues[T](newCtx, r.config.keys, key.String(), values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+/*
+		DistinctAs returns the distinct values of key among the documents matching the query,
+		decoded into V.
+
+	 	Example usage:
+
+		query, _ := querybuilder.New().EqualString("status", "active").Build()
+		countries, err := DistinctAs[string](ctx, usersRepo, "country", query)
+*/
+func DistinctAs[V any, T any](ctx context.Context, repo Repository[T], key querybuilder.KeyMongoDB, query *querybuilder.Query) ([]V, error) {
+	values, err := repo.Distinct(ctx, key, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]V, 0, len(values))
+
+	for _, value := range values {
+		t, data, err := bson.MarshalValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		var item V
+		if err = (bson.RawValue{Type: t, Value: data}).Unmarshal(&item); err != nil {
+			return nil, err
+		}
+
+		resp = append(resp, item)
+	}
+
+	return resp, nil
+}
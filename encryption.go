@@ -0,0 +1,769 @@
+package mongokit
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/dinson/mongokit/querybuilder"
+	"github.com/dinson/mongokit/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	tagEncrypt       = "encrypt"
+	tagDeterministic = "deterministic"
+
+	encryptedPrefix   = "enc:"
+	modeRandom        = "r"
+	modeDeterministic = "d"
+)
+
+// KeyProvider supplies the 32 byte AES-256 keys used to encrypt fields tagged with `mongokit:"encrypt"`.
+//
+// The id of the key is stored with every encrypted value, so that keys can be rotated:
+// new values are encrypted with the current key, existing values are decrypted with the key they were written with.
+//
+// Keys are requested once per operation, providers backed by a key management service should cache them.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are encrypted with
+	CurrentKey(ctx context.Context) (keyID string, key []byte, err error)
+	// Key returns the key with the given id
+	Key(ctx context.Context, keyID string) ([]byte, error)
+	// KeyIDs returns the ids of every key values may be encrypted with, so that
+	// equality filters on deterministic fields match values written before a rotation
+	KeyIDs(ctx context.Context) ([]string, error)
+}
+
+type staticKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// StaticKeys returns a KeyProvider serving fixed keys by id, encrypting new values with the key currentID
+func StaticKeys(currentID string, keys map[string][]byte) KeyProvider {
+	return staticKeys{current: currentID, keys: keys}
+}
+
+func (s staticKeys) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := s.Key(ctx, s.current)
+	return s.current, key, err
+}
+
+func (s staticKeys) Key(_ context.Context, keyID string) ([]byte, error) {
+	key, ok := s.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownKey, keyID)
+	}
+	return key, nil
+}
+
+func (s staticKeys) KeyIDs(_ context.Context) ([]string, error) {
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+/*
+		WithEncryption encrypts the fields of T tagged with `mongokit:"encrypt"` on writes and decrypts them on reads,
+		with the keys of provider. Encrypted fields must be of type string or *string.
+
+		By default a value encrypts differently on every write. Fields tagged `mongokit:"encrypt,deterministic"`
+		always encrypt the same value to the same ciphertext under the same key, which allows equality filters
+		such as EqualString on them: filter values are encrypted under every key of KeyIDs before the query runs,
+		so documents written before a key rotation still match. Other operators cannot be used on encrypted fields.
+
+	 	Example usage:
+
+		type User struct {
+			ID    *primitive.ObjectID `bson:"_id,omitempty"`
+			Email string              `bson:"email" mongokit:"encrypt,deterministic"`
+			Phone string              `bson:"phone" mongokit:"encrypt"`
+		}
+
+		usersRepo := NewRepository[User](collection, WithEncryption(StaticKeys("2024-01", keys)))
+*/
+func WithEncryption(provider KeyProvider) Option {
+	return func(r *repositoryConfig) {
+		r.keys = provider
+	}
+}
+
+type encryptedField struct {
+	path          string
+	index         []int
+	pointer       bool // *string instead of string
+	deterministic bool
+}
+
+type encryptedFieldsEntry struct {
+	fields []encryptedField
+	err    error
+}
+
+var encryptedFieldCache sync.Map // map[reflect.Type]encryptedFieldsEntry
+
+// encryptedFields returns the fields of t tagged with `mongokit:"encrypt"`
+func encryptedFields(t reflect.Type) ([]encryptedField, error) {
+	if cached, ok := encryptedFieldCache.Load(t); ok {
+		entry := cached.(encryptedFieldsEntry)
+		return entry.fields, entry.err
+	}
+
+	var fields []encryptedField
+	var err error
+
+	for _, f := range utils.BSONFields(t) {
+		opts := tagOptions(f)
+		if !opts[tagEncrypt] {
+			continue
+		}
+
+		isString := f.Type.Kind() == reflect.String
+		isStringPtr := f.Type.Kind() == reflect.Pointer && f.Type.Elem().Kind() == reflect.String
+		if f.Index == nil || (!isString && !isStringPtr) {
+			err = fmt.Errorf("%w: %s", errUnsupportedEncryptedField, f.Path)
+			break
+		}
+
+		fields = append(fields, encryptedField{
+			path:          f.Path,
+			index:         f.Index,
+			pointer:       isStringPtr,
+			deterministic: opts[tagDeterministic],
+		})
+	}
+
+	encryptedFieldCache.Store(t, encryptedFieldsEntry{fields: fields, err: err})
+	return fields, err
+}
+
+// fieldCipher encrypts and decrypts the values of a single operation, fetching each key once
+type fieldCipher struct {
+	ctx       context.Context
+	provider  KeyProvider
+	currentID string
+	keyIDs    []string
+	aeads     map[string]cipher.AEAD
+	macKeys   map[string][]byte
+}
+
+func newFieldCipher(ctx context.Context, provider KeyProvider) *fieldCipher {
+	return &fieldCipher{
+		ctx:      ctx,
+		provider: provider,
+		aeads:    map[string]cipher.AEAD{},
+		macKeys:  map[string][]byte{},
+	}
+}
+
+// key returns the cipher and nonce derivation key of keyID, or of the current key when keyID is empty
+func (c *fieldCipher) key(keyID string) (string, cipher.AEAD, []byte, error) {
+	if keyID == "" && c.currentID != "" {
+		keyID = c.currentID
+	}
+	if aead, ok := c.aeads[keyID]; ok {
+		return keyID, aead, c.macKeys[keyID], nil
+	}
+
+	var key []byte
+	var err error
+	if keyID == "" {
+		keyID, key, err = c.provider.CurrentKey(c.ctx)
+		c.currentID = keyID
+	} else {
+		key, err = c.provider.Key(c.ctx, keyID)
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if len(key) != 32 {
+		return "", nil, nil, fmt.Errorf("%w: %s", errInvalidKey, keyID)
+	}
+
+	// separate keys for encryption and nonce derivation
+	block, err := aes.NewCipher(deriveKey(key, "mongokit-encryption"))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	c.aeads[keyID] = aead
+	c.macKeys[keyID] = deriveKey(key, "mongokit-nonce")
+	return keyID, aead, c.macKeys[keyID], nil
+}
+
+// encryptAll returns the deterministic ciphertexts of a value under every key of the provider,
+// the current key first
+func (c *fieldCipher) encryptAll(path, plaintext string) ([]string, error) {
+	if c.keyIDs == nil {
+		currentID, _, _, err := c.key("")
+		if err != nil {
+			return nil, err
+		}
+		ids, err := c.provider.KeyIDs(c.ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.keyIDs = []string{currentID}
+		for _, id := range ids {
+			if id != currentID {
+				c.keyIDs = append(c.keyIDs, id)
+			}
+		}
+	}
+
+	resp := make([]string, len(c.keyIDs))
+	for i, keyID := range c.keyIDs {
+		encrypted, err := c.encryptWith(keyID, path, plaintext, true)
+		if err != nil {
+			return nil, err
+		}
+		resp[i] = encrypted
+	}
+	return resp, nil
+}
+
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// encrypt returns the stored form of a value: enc:<mode>:<key id>:<base64 nonce and ciphertext>.
+// The field path is authenticated, so a value cannot be copied to another field.
+func (c *fieldCipher) encrypt(path, plaintext string, deterministic bool) (string, error) {
+	return c.encryptWith("", path, plaintext, deterministic)
+}
+
+// encryptWith encrypts with the key keyID, or with the current key when keyID is empty
+func (c *fieldCipher) encryptWith(keyID, path, plaintext string, deterministic bool) (string, error) {
+	keyID, aead, macKey, err := c.key(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	mode := modeRandom
+	if deterministic {
+		mode = modeDeterministic
+		mac := hmac.New(sha256.New, macKey)
+		mac.Write([]byte(path))
+		mac.Write([]byte{0})
+		mac.Write([]byte(plaintext))
+		copy(nonce, mac.Sum(nil))
+	} else if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(path))
+	return encryptedPrefix + mode + ":" + keyID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns the plaintext of a stored value. Values that are not encrypted are returned as they are.
+func (c *fieldCipher) decrypt(path, stored string) (string, error) {
+	keyID, sealed, ok := parseEncrypted(stored)
+	if !ok {
+		// not written by encrypt, e.g. a value stored before the field was encrypted
+		return stored, nil
+	}
+
+	_, aead, _, err := c.key(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return "", fmt.Errorf("%w: %s", errInvalidCiphertext, path)
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", errInvalidCiphertext, path)
+	}
+
+	return string(plaintext), nil
+}
+
+// parseEncrypted splits a value in the stored form of encrypt into its key id and sealed bytes,
+// ok is false for any other value
+func parseEncrypted(stored string) (keyID string, sealed []byte, ok bool) {
+	rest, found := strings.CutPrefix(stored, encryptedPrefix)
+	if !found {
+		return "", nil, false
+	}
+
+	mode, rest, found := strings.Cut(rest, ":")
+	if !found || (mode != modeRandom && mode != modeDeterministic) {
+		return "", nil, false
+	}
+
+	// the key id runs up to the last separator
+	sep := strings.LastIndex(rest, ":")
+	if sep <= 0 {
+		return "", nil, false
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(rest[sep+1:])
+	if err != nil || len(sealed) == 0 {
+		return "", nil, false
+	}
+
+	return rest[:sep], sealed, true
+}
+
+// encryptDoc returns a copy of doc with its encrypted fields encrypted, leaving doc untouched.
+// Structs reached through pointers on the way to an encrypted field are copied as well.
+func encryptDoc[T any](ctx context.Context, provider KeyProvider, doc *T) (*T, error) {
+	if provider == nil || doc == nil {
+		return doc, nil
+	}
+
+	fields, err := encryptedFields(reflect.TypeOf(doc).Elem())
+	if err != nil || len(fields) == 0 {
+		return doc, err
+	}
+
+	c := newFieldCipher(ctx, provider)
+
+	clone := new(T)
+	*clone = *doc
+	root := reflect.ValueOf(clone).Elem()
+
+	for _, f := range fields {
+		field, ok := copyPath(root, f.index)
+		if !ok {
+			continue
+		}
+
+		value := field
+		if f.pointer {
+			if field.IsNil() {
+				continue
+			}
+			value = reflect.New(field.Type().Elem()).Elem()
+			value.Set(field.Elem())
+		}
+
+		ciphertext, err := c.encrypt(f.path, value.String(), f.deterministic)
+		if err != nil {
+			return nil, err
+		}
+		value.SetString(ciphertext)
+
+		if f.pointer {
+			field.Set(value.Addr())
+		}
+	}
+
+	return clone, nil
+}
+
+// copyPath returns the field at index, replacing every pointer to a struct on the way with a pointer to a copy.
+// It reports false when a pointer on the way is nil.
+func copyPath(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			ptr := reflect.New(v.Type().Elem())
+			ptr.Elem().Set(v.Elem())
+			v.Set(ptr)
+			v = ptr.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v, true
+}
+
+// marshalDoc encodes doc for an insert with marshalWithID, with its encrypted fields encrypted.
+// A generated id is also assigned to doc, so that retrying a failed batch with the same documents
+// cannot insert them twice.
+func (r repositoryImpl[T]) marshalDoc(ctx context.Context, doc *T) (bson.Raw, any, error) {
+	encrypted, err := encryptDoc(ctx, r.config.keys, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, id, err := marshalWithID(encrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+	setID(doc, id)
+
+	return raw, id, nil
+}
+
+// decryptDocs decrypts the encrypted fields of docs in place
+func decryptDocs[R any](ctx context.Context, provider KeyProvider, docs ...*R) error {
+	values := make([]reflect.Value, 0, len(docs))
+	for _, doc := range docs {
+		if doc != nil {
+			values = append(values, reflect.ValueOf(doc))
+		}
+	}
+
+	return decryptStructs(ctx, provider, reflect.TypeOf((*R)(nil)).Elem(), values)
+}
+
+// decryptStructs decrypts the encrypted fields of docs in place, pointers to structs of type t
+func decryptStructs(ctx context.Context, provider KeyProvider, t reflect.Type, docs []reflect.Value) error {
+	if provider == nil || len(docs) == 0 {
+		return nil
+	}
+
+	fields, err := encryptedFields(t)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+
+	c := newFieldCipher(ctx, provider)
+
+	for _, doc := range docs {
+		root := doc.Elem()
+
+		for _, f := range fields {
+			field, err := root.FieldByIndexErr(f.index)
+			if err != nil {
+				continue // nil pointer on the way
+			}
+
+			value := field
+			if f.pointer {
+				if field.IsNil() {
+					continue
+				}
+				value = field.Elem()
+			}
+
+			plaintext, err := c.decrypt(f.path, value.String())
+			if err != nil {
+				return err
+			}
+			value.SetString(plaintext)
+		}
+	}
+
+	return nil
+}
+
+// encryptQuery returns a copy of the query whose equality filters on deterministic fields compare encrypted values.
+// Filtering on a randomly encrypted field, or with another operator, fails.
+func encryptQuery[T any](ctx context.Context, provider KeyProvider, query *querybuilder.Query) (*querybuilder.Query, error) {
+	if provider == nil || query == nil {
+		return query, nil
+	}
+
+	fields, err := encryptedFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil || len(fields) == 0 {
+		return query, err
+	}
+
+	byPath := make(map[string]encryptedField, len(fields))
+	for _, f := range fields {
+		byPath[f.path] = f
+	}
+
+	rw := &filterEncrypter{cipher: newFieldCipher(ctx, provider), fields: byPath}
+	encrypted := *query
+
+	if query.RawQuery != nil {
+		if encrypted.RawQuery, err = rw.filter(query.RawQuery); err != nil {
+			return nil, err
+		}
+	}
+	if query.BatchFilters != nil {
+		batch, err := rw.filter(query.BatchFilters)
+		if err != nil {
+			return nil, err
+		}
+		encrypted.BatchFilters = batch.(bson.M)
+	}
+	if query.Filters != nil {
+		encrypted.Filters = make([]bson.D, len(query.Filters))
+		for i, f := range query.Filters {
+			filter, err := rw.filter(f)
+			if err != nil {
+				return nil, err
+			}
+			encrypted.Filters[i] = filter.(bson.D)
+		}
+	}
+	if query.Aggregate != nil {
+		encrypted.Aggregate = make(bson.A, len(query.Aggregate))
+		for i, stage := range query.Aggregate {
+			if encrypted.Aggregate[i], err = rw.stage(stage); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &encrypted, nil
+}
+
+type filterEncrypter struct {
+	cipher *fieldCipher
+	fields map[string]encryptedField
+}
+
+// filter rewrites a filter document, returning bson.D, Condition and bson.M with the same type.
+// Documents of other types are rewritten as bson.D.
+func (rw *filterEncrypter) filter(filter any) (any, error) {
+	switch f := filter.(type) {
+	case nil:
+		return nil, nil
+	case bson.D:
+		resp := make(bson.D, len(f))
+		for i, e := range f {
+			value, err := rw.element(e.Key, e.Value)
+			if err != nil {
+				return nil, err
+			}
+			resp[i] = bson.E{Key: e.Key, Value: value}
+		}
+		return resp, nil
+	case querybuilder.Condition:
+		resp, err := rw.filter(bson.D(f))
+		if err != nil {
+			return nil, err
+		}
+		return querybuilder.Condition(resp.(bson.D)), nil
+	case bson.M:
+		resp := make(bson.M, len(f))
+		for key, v := range f {
+			value, err := rw.element(key, v)
+			if err != nil {
+				return nil, err
+			}
+			resp[key] = value
+		}
+		return resp, nil
+	}
+
+	// any other document type, e.g. a map or a struct, is checked in its encoded form
+	data, err := bson.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errEncryptedFieldFilter, err)
+	}
+	var doc bson.D
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", errEncryptedFieldFilter, err)
+	}
+	return rw.filter(doc)
+}
+
+func (rw *filterEncrypter) element(key string, value any) (any, error) {
+	switch key {
+	case "$and", "$or", "$nor":
+		if filters, ok := value.([]bson.D); ok {
+			resp := make([]bson.D, len(filters))
+			for i, f := range filters {
+				filter, err := rw.filter(f)
+				if err != nil {
+					return nil, err
+				}
+				resp[i] = filter.(bson.D)
+			}
+			return resp, nil
+		}
+
+		// bson.A, []any, []bson.M and any other slice of documents, bson.D is a single document
+		_, isDoc := value.(bson.D)
+		_, isCondition := value.(querybuilder.Condition)
+		groups := reflect.ValueOf(value)
+		if isDoc || isCondition || (groups.Kind() != reflect.Slice && groups.Kind() != reflect.Array) {
+			return nil, fmt.Errorf("%w: %s is not an array", errEncryptedFieldFilter, key)
+		}
+		resp := make(bson.A, groups.Len())
+		for i := range resp {
+			filter, err := rw.filter(groups.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			resp[i] = filter
+		}
+		return resp, nil
+	}
+
+	f, ok := rw.fields[key]
+	if !ok {
+		return value, nil
+	}
+	if !f.deterministic {
+		return nil, fmt.Errorf("%w: %s", errEncryptedFieldFilter, key)
+	}
+
+	return rw.value(f, value)
+}
+
+// value encrypts a filter value of a deterministic field: a string, or $eq, $ne, $in and $nin of strings.
+// A value matches its ciphertext under every key, equality becomes $in and inequality $nin.
+func (rw *filterEncrypter) value(f encryptedField, value any) (any, error) {
+	switch v := value.(type) {
+	case string, *string, nil:
+		encrypted, err := rw.ciphertexts(f, v)
+		if err != nil {
+			return nil, err
+		}
+		if len(encrypted) == 1 {
+			return encrypted[0], nil
+		}
+		return bson.D{{"$in", encrypted}}, nil
+	case bson.D:
+		resp := make(bson.D, len(v))
+		for i, e := range v {
+			op, operand, err := rw.operator(f, e.Key, e.Value)
+			if err != nil {
+				return nil, err
+			}
+			resp[i] = bson.E{Key: op, Value: operand}
+		}
+		return resp, nil
+	case bson.M:
+		resp := make(bson.M, len(v))
+		for op, operand := range v {
+			op, encrypted, err := rw.operator(f, op, operand)
+			if err != nil {
+				return nil, err
+			}
+			resp[op] = encrypted
+		}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", errEncryptedFieldFilter, f.path)
+}
+
+// operator encrypts the operand of an operator, returning the operator to use with the encrypted operand
+func (rw *filterEncrypter) operator(f encryptedField, op string, operand any) (string, any, error) {
+	switch op {
+	case "$eq", "$ne":
+		encrypted, err := rw.ciphertexts(f, operand)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(encrypted) == 1 {
+			return op, encrypted[0], nil
+		}
+		if op == "$eq" {
+			return "$in", encrypted, nil
+		}
+		return "$nin", encrypted, nil
+	case "$in", "$nin":
+		values := reflect.ValueOf(operand)
+		if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+			break
+		}
+		resp := bson.A{}
+		for i := 0; i < values.Len(); i++ {
+			encrypted, err := rw.ciphertexts(f, values.Index(i).Interface())
+			if err != nil {
+				return "", nil, err
+			}
+			resp = append(resp, encrypted...)
+		}
+		return op, resp, nil
+	case "$exists":
+		return op, operand, nil
+	}
+
+	return "", nil, fmt.Errorf("%w: %s %s", errEncryptedFieldFilter, op, f.path)
+}
+
+// ciphertexts returns the stored forms a string value may have, one per key. nil values are kept.
+func (rw *filterEncrypter) ciphertexts(f encryptedField, value any) (bson.A, error) {
+	var plaintext string
+	switch v := value.(type) {
+	case nil:
+		return bson.A{nil}, nil
+	case *string:
+		if v == nil {
+			return bson.A{nil}, nil
+		}
+		plaintext = *v
+	case string:
+		plaintext = v
+	default:
+		return nil, fmt.Errorf("%w: %s", errEncryptedFieldFilter, f.path)
+	}
+
+	encrypted, err := rw.cipher.encryptAll(f.path, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make(bson.A, len(encrypted))
+	for i, e := range encrypted {
+		resp[i] = e
+	}
+	return resp, nil
+}
+
+// stage rewrites the filter of a $match stage, leaving other stages as they are
+func (rw *filterEncrypter) stage(stage any) (any, error) {
+	switch d := stage.(type) {
+	case bson.D:
+		if len(d) == 1 && d[0].Key == "$match" {
+			filter, err := rw.filter(d[0].Value)
+			if err != nil {
+				return nil, err
+			}
+			return bson.D{{"$match", filter}}, nil
+		}
+	case bson.M:
+		if match, ok := d["$match"]; ok && len(d) == 1 {
+			filter, err := rw.filter(match)
+			if err != nil {
+				return nil, err
+			}
+			return bson.M{"$match": filter}, nil
+		}
+	}
+
+	return stage, nil
+}
+
+// decryptValues decrypts distinct values of key when it is an encrypted field of T
+func decryptValues[T any](ctx context.Context, provider KeyProvider, key string, values []any) error {
+	if provider == nil {
+		return nil
+	}
+
+	fields, err := encryptedFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if f.path != key {
+			continue
+		}
+
+		c := newFieldCipher(ctx, provider)
+		for i, v := range values {
+			if s, ok := v.(string); ok {
+				if values[i], err = c.decrypt(f.path, s); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
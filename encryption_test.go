@@ -0,0 +1,161 @@
+package mongokit
+
+import (
+	"context"
+	"errors"
+	"github.com/dinson/mongokit/querybuilder"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+)
+
+type encryptedDoc struct {
+	ID    any     `bson:"_id,omitempty"`
+	Email string  `bson:"email" mongokit:"encrypt,deterministic"`
+	Phone *string `bson:"phone" mongokit:"encrypt"`
+	Name  string  `bson:"name"`
+}
+
+func testKeys(currentID string, ids ...string) KeyProvider {
+	keys := map[string][]byte{}
+	for i, id := range ids {
+		key := make([]byte, 32)
+		key[0] = byte(i + 1)
+		keys[id] = key
+	}
+	return StaticKeys(currentID, keys)
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys("k1", "k1")
+
+	phone := "+49 30 1234"
+	doc := &encryptedDoc{Email: "dan@example.com", Phone: &phone, Name: "Dan"}
+
+	encrypted, err := encryptDoc(ctx, keys, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Email != "dan@example.com" || *doc.Phone != phone {
+		t.Fatalf("the caller's document was encrypted: %+v", doc)
+	}
+	if !strings.HasPrefix(encrypted.Email, "enc:d:k1:") || !strings.HasPrefix(*encrypted.Phone, "enc:r:k1:") {
+		t.Fatalf("got %q and %q", encrypted.Email, *encrypted.Phone)
+	}
+	if encrypted.Name != "Dan" {
+		t.Errorf("a field that is not encrypted changed: %q", encrypted.Name)
+	}
+
+	if err = decryptDocs(ctx, keys, encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.Email != doc.Email || *encrypted.Phone != phone {
+		t.Errorf("got %q and %q after decryption", encrypted.Email, *encrypted.Phone)
+	}
+}
+
+func TestDecryptKeepsPlaintext(t *testing.T) {
+	c := newFieldCipher(context.Background(), testKeys("k1", "k1"))
+
+	for _, stored := range []string{"plain", "enc:", "enc:x:k1:AAAA", "enc:r:k1:not base64!"} {
+		got, err := c.decrypt("email", stored)
+		if err != nil || got != stored {
+			t.Errorf("%q: got %q, %v", stored, got, err)
+		}
+	}
+
+	encrypted, err := c.encrypt("email", "dan@example.com", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.decrypt("phone", encrypted); !errors.Is(err, errInvalidCiphertext) {
+		t.Errorf("a value copied to another field: got %v", err)
+	}
+}
+
+func TestDeterministicEquality(t *testing.T) {
+	c := newFieldCipher(context.Background(), testKeys("k1", "k1"))
+
+	first, err := c.encrypt("email", "dan@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.encrypt("email", "dan@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("deterministic values differ: %q and %q", first, second)
+	}
+
+	random, err := c.encrypt("email", "dan@example.com", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if random == first {
+		t.Error("random encryption is deterministic")
+	}
+
+	query, err := querybuilder.New().EqualString("email", "dan@example.com").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptQuery[encryptedDoc](context.Background(), testKeys("k1", "k1"), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := encrypted.Filters[0][0].Value; got != first {
+		t.Errorf("filter value %v, want %q", got, first)
+	}
+}
+
+func TestDeterministicEqualityAfterRotation(t *testing.T) {
+	ctx := context.Background()
+
+	old, err := newFieldCipher(ctx, testKeys("k1", "k1", "k2")).encrypt("email", "dan@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := &querybuilder.Query{RawQuery: bson.M{"$or": []bson.M{
+		{"email": "dan@example.com"},
+		{"email": bson.M{"$ne": "eve@example.com"}},
+	}}}
+	encrypted, err := encryptQuery[encryptedDoc](ctx, testKeys("k2", "k1", "k2"), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := encrypted.RawQuery.(bson.M)["$or"].(bson.A)
+
+	in := groups[0].(bson.M)["email"].(bson.D)
+	if in[0].Key != "$in" || len(in[0].Value.(bson.A)) != 2 || in[0].Value.(bson.A)[1] != old {
+		t.Errorf("equality: got %v, want $in with the value under k2 and k1 %q", in, old)
+	}
+
+	nin := groups[1].(bson.M)["email"].(bson.M)
+	if values, ok := nin["$nin"].(bson.A); !ok || len(values) != 2 {
+		t.Errorf("inequality: got %v, want $nin with two values", nin)
+	}
+}
+
+func TestEncryptedFieldFilterRejected(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys("k1", "k1")
+
+	tests := map[string]*querybuilder.Query{
+		"range on a deterministic field": {Filters: []bson.D{{{"email", bson.D{{"$gt", "a"}}}}}},
+		"regex on a deterministic field": {Filters: []bson.D{{{"email", bson.D{{"$regex", "^dan"}}}}}},
+		"equality on a random field":     {Filters: []bson.D{{{"phone", "+49"}}}},
+		"random field inside []any":      {RawQuery: bson.D{{"$and", []any{bson.D{{"phone", "+49"}}}}}},
+		"group that is not an array":     {RawQuery: bson.D{{"$or", bson.D{{"email", "x"}}}}},
+		"random field in a $match stage": {Aggregate: bson.A{bson.M{"$match": bson.M{"phone": "+49"}}}},
+	}
+
+	for name, query := range tests {
+		if _, err := encryptQuery[encryptedDoc](ctx, keys, query); !errors.Is(err, errEncryptedFieldFilter) {
+			t.Errorf("%s: got %v, want %v", name, err, errEncryptedFieldFilter)
+		}
+	}
+}
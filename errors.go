@@ -0,0 +1,35 @@
+package mongokit
+
+import "errors"
+
+var (
+	errUnsupportedRepository = errors.New("UNSUPPORTED_REPOSITORY")
+	errInvalidRefTag         = errors.New("INVALID_REF_TAG")
+	errUnknownRefField       = errors.New("UNKNOWN_REF_FIELD")
+	errBulkWriteFailed       = errors.New("BULK_WRITE_FAILED")
+	errInvalidWriteModel     = errors.New("INVALID_WRITE_MODEL")
+	errInsertManyFailed      = errors.New("INSERT_MANY_FAILED")
+	errNotAttempted          = errors.New("NOT_ATTEMPTED")
+	errMissingStreamName     = errors.New("MISSING_STREAM_NAME")
+	errAuditFailed           = errors.New("AUDIT_FAILED")
+	errMissingTenant         = errors.New("MISSING_TENANT")
+	errMissingTenantField    = errors.New("MISSING_TENANT_FIELD")
+	errTenantMismatch        = errors.New("TENANT_MISMATCH")
+	errInvalidTenant         = errors.New("INVALID_TENANT")
+	errNilDocument           = errors.New("NIL_DOCUMENT")
+	errUnscopedPopulate      = errors.New("POPULATE_NOT_TENANT_SCOPED")
+	errUnresolvedRelated     = errors.New("UNRESOLVED_RELATED_COLLECTION")
+)
+
+var (
+	errUnknownKey                = errors.New("UNKNOWN_ENCRYPTION_KEY")
+	errInvalidKey                = errors.New("INVALID_ENCRYPTION_KEY")
+	errInvalidCiphertext         = errors.New("INVALID_CIPHERTEXT")
+	errUnsupportedEncryptedField = errors.New("UNSUPPORTED_ENCRYPTED_FIELD")
+	errEncryptedFieldFilter      = errors.New("UNSUPPORTED_ENCRYPTED_FIELD_FILTER")
+)
+
+var (
+	errUnsupportedWatchStage  = errors.New("UNSUPPORTED_WATCH_STAGE")
+	errUnsupportedWatchFilter = errors.New("UNSUPPORTED_WATCH_FILTER")
+)
@@ -3,50 +3,122 @@ package mongokit
 import (
 	"context"
 	"github.com/dinson/mongokit/querybuilder"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 )
 
+// cursorFinder is implemented by repositories that can run a find or an aggregation and hand back the cursor,
+// which lets the package level generic functions decode results into types other than T.
+type cursorFinder interface {
+	findCursor(ctx context.Context, query *querybuilder.Query) (*mongo.Cursor, error)
+	aggregateCursor(ctx context.Context, query *querybuilder.Query) (*mongo.Cursor, error)
+	// keyProvider returns the keys to decrypt results with, nil when the repository does not encrypt fields
+	keyProvider() KeyProvider
+}
+
 func (r repositoryImpl[T]) FindAll(ctx context.Context, filter *querybuilder.Query) ([]*T, error) {
 	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
 	defer cancel()
 
-	var filters any
-	if filter.RawQuery != nil {
-		filters = filter.RawQuery
-	} else {
-		if filter.BatchFilters != nil {
-			filters = filter.BatchFilters
-		} else {
-			if len(filter.Filters) > 0 {
-				filters = bson.D{{"$and", filter.Filters}}
-			} else {
-				filters = bson.D{}
-			}
+	cursor, err := r.findCursor(newCtx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := decodeDecrypted[T](newCtx, r.config.keys, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.populateResults(newCtx, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+/*
+		FindAllAs returns all the matching documents decoded into R instead of the model of the repository.
+
+		Meant to be used with a projection, so that only the fields of a smaller DTO are read.
+
+	 	Example usage:
+
+		type UserName struct {
+			Name string `bson:"name"`
 		}
+
+		query, _ := querybuilder.New().EqualString("status", "active").Select("name").Build()
+		names, err := FindAllAs[UserName](ctx, usersRepo, query)
+*/
+func FindAllAs[R any, T any](ctx context.Context, repo Repository[T], query *querybuilder.Query) ([]*R, error) {
+	finder, ok := repo.(cursorFinder)
+	if !ok {
+		return nil, errUnsupportedRepository
 	}
 
-	cursor, err := r.collection.Find(newCtx, filters, filter.Options)
-	defer func(cursor *mongo.Cursor, ctx context.Context) {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	cursor, err := finder.findCursor(newCtx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDecrypted[R](newCtx, finder.keyProvider(), cursor)
+}
+
+func (r repositoryImpl[T]) findCursor(ctx context.Context, query *querybuilder.Query) (*mongo.Cursor, error) {
+	query, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(ctx, query.GetFilter(), query.Options)
+	if err != nil {
 		if cursor != nil {
-			err = cursor.Close(ctx)
-			if err != nil {
-				log.Println(err)
-			}
+			_ = cursor.Close(ctx)
 		}
-	}(cursor, newCtx)
+		return nil, err
+	}
 
+	return cursor, nil
+}
+
+// decodeDecrypted reads every document of the cursor into R, decrypting its encrypted fields with keys
+func decodeDecrypted[R any](ctx context.Context, keys KeyProvider, cursor *mongo.Cursor) ([]*R, error) {
+	resp, err := decodeAll[R](ctx, cursor)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp []*T
+	if err = decryptDocs(ctx, keys, resp...); err != nil {
+		return nil, err
+	}
 
-	for cursor.Next(newCtx) {
-		var item *T
+	return resp, nil
+}
 
-		err = cursor.Decode(&item)
+// decodeAll reads every document of the cursor into R and closes it
+func decodeAll[R any](ctx context.Context, cursor *mongo.Cursor) ([]*R, error) {
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	var resp []*R
+
+	for cursor.Next(ctx) {
+		var item *R
+
+		err := cursor.Decode(&item)
 		if err != nil {
 			return nil, err
 		}
@@ -54,5 +126,5 @@ func (r repositoryImpl[T]) FindAll(ctx context.Context, filter *querybuilder.Que
 		resp = append(resp, item)
 	}
 
-	return resp, nil
+	return resp, cursor.Err()
 }
@@ -13,6 +13,11 @@ func (r repositoryImpl[T]) FindOne(ctx context.Context, filter *querybuilder.Que
 	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
 	defer cancel()
 
+	filter, err := r.prepare(newCtx, filter)
+	if err != nil {
+		return nil, err
+	}
+
 	var filters any
 	if filter.RawQuery != nil {
 		filters = filter.RawQuery
@@ -30,8 +35,14 @@ func (r repositoryImpl[T]) FindOne(ctx context.Context, filter *querybuilder.Que
 
 	findOneOptions := options.FindOne()
 	findOneOptions.Sort = filter.Options.Sort
+	findOneOptions.Projection = filter.Options.Projection
+
+	collection, err := r.resolve(newCtx)
+	if err != nil {
+		return nil, err
+	}
 
-	result := r.collection.FindOne(newCtx, filters, findOneOptions)
+	result := collection.FindOne(newCtx, filters, findOneOptions)
 
 	if errors.Is(result.Err(), mongo.ErrNoDocuments) {
 		return nil, nil
@@ -43,5 +54,13 @@ func (r repositoryImpl[T]) FindOne(ctx context.Context, filter *querybuilder.Que
 		return nil, err
 	}
 
+	if err := decryptDocs(newCtx, r.config.keys, resp); err != nil {
+		return nil, err
+	}
+
+	if err := r.populateResults(newCtx, []*T{resp}); err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
@@ -0,0 +1,70 @@
+// Package geojson provides the GeoJSON geometries stored in documents and used in geospatial queries.
+//
+// Coordinates are always in longitude, latitude order, as required by MongoDB.
+package geojson
+
+const (
+	TypePoint   = "Point"
+	TypePolygon = "Polygon"
+)
+
+// Point is a GeoJSON point.
+//
+// Declare a 2dsphere index on a model field with the mongokit struct tag:
+//
+//	Location geojson.Point `bson:"location" mongokit:"2dsphere"`
+type Point struct {
+	Type        string     `bson:"type" json:"type"`
+	Coordinates [2]float64 `bson:"coordinates" json:"coordinates"` // longitude, latitude
+}
+
+// NewPoint creates a point from a longitude and a latitude
+func NewPoint(lng, lat float64) Point {
+	return Point{
+		Type:        TypePoint,
+		Coordinates: [2]float64{lng, lat},
+	}
+}
+
+// Lng returns the longitude of the point
+func (p Point) Lng() float64 {
+	return p.Coordinates[0]
+}
+
+// Lat returns the latitude of the point
+func (p Point) Lat() float64 {
+	return p.Coordinates[1]
+}
+
+// Polygon is a GeoJSON polygon made of an exterior ring and optional interior rings (holes)
+type Polygon struct {
+	Type        string         `bson:"type" json:"type"`
+	Coordinates [][][2]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewPolygon creates a polygon from its rings, each a list of longitude, latitude positions.
+// Rings that are not closed are closed by repeating their first position.
+func NewPolygon(rings ...[][2]float64) Polygon {
+	coordinates := make([][][2]float64, 0, len(rings))
+	for _, ring := range rings {
+		if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+			ring = append(ring[:len(ring):len(ring)], ring[0])
+		}
+		coordinates = append(coordinates, ring)
+	}
+
+	return Polygon{
+		Type:        TypePolygon,
+		Coordinates: coordinates,
+	}
+}
+
+// NewBox creates a rectangular polygon from its bottom left and top right corners
+func NewBox(bottomLeft, topRight Point) Polygon {
+	return NewPolygon([][2]float64{
+		{bottomLeft.Lng(), bottomLeft.Lat()},
+		{topRight.Lng(), bottomLeft.Lat()},
+		{topRight.Lng(), topRight.Lat()},
+		{bottomLeft.Lng(), topRight.Lat()},
+	})
+}
@@ -0,0 +1,148 @@
+package mongokit
+
+import (
+	"fmt"
+	"github.com/dinson/mongokit/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NonObjectIDError reports inserted documents whose _id is not an ObjectID.
+// The documents were inserted, only their ids cannot be returned as ObjectIDs.
+type NonObjectIDError struct {
+	IDs map[int]any // input index -> _id
+}
+
+func (e *NonObjectIDError) Error() string {
+	indexes := make([]int, 0, len(e.IDs))
+	for i := range e.IDs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	parts := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		parts = append(parts, fmt.Sprintf("%d: %T", i, e.IDs[i]))
+	}
+	return fmt.Sprintf("NON_OBJECT_ID: %s", strings.Join(parts, ", "))
+}
+
+// ObjectIDs returns the inserted ids as ObjectIDs, at their input index,
+// with a *NonObjectIDError listing the documents whose _id is of another type.
+func (r *InsertManyResult) ObjectIDs() ([]*primitive.ObjectID, error) {
+	resp := make([]*primitive.ObjectID, len(r.InsertedIDs))
+	nonObjectIDs := map[int]any{}
+
+	for i, id := range r.InsertedIDs {
+		if id == nil {
+			continue
+		}
+		oid, ok := id.(primitive.ObjectID)
+		if !ok {
+			nonObjectIDs[i] = id
+			continue
+		}
+		resp[i] = &oid
+	}
+
+	if len(nonObjectIDs) > 0 {
+		return resp, &NonObjectIDError{IDs: nonObjectIDs}
+	}
+
+	return resp, nil
+}
+
+var idFieldCache sync.Map // map[reflect.Type][]int, nil when the type has no _id field
+
+// idFieldIndex returns the index of the field of t encoded as _id
+func idFieldIndex(t reflect.Type) ([]int, bool) {
+	if cached, ok := idFieldCache.Load(t); ok {
+		index := cached.([]int)
+		return index, index != nil
+	}
+
+	var index []int
+	for _, f := range utils.BSONFields(t) {
+		if f.Path == "_id" && f.Index != nil {
+			index = f.Index
+			break
+		}
+	}
+
+	idFieldCache.Store(t, index)
+	return index, index != nil
+}
+
+// idField returns the settable _id field of doc, a pointer to a struct
+func idField(doc any) (reflect.Value, bool) {
+	v := reflect.ValueOf(doc)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	index, ok := idFieldIndex(v.Elem().Type())
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	field, err := v.Elem().FieldByIndexErr(index)
+	if err != nil || !field.CanSet() {
+		return reflect.Value{}, false
+	}
+
+	return field, true
+}
+
+// setID assigns id to the _id field of doc when the field is empty and can hold the id
+func setID(doc any, id any) {
+	field, ok := idField(doc)
+	if !ok || !field.IsZero() || id == nil {
+		return
+	}
+
+	value := reflect.ValueOf(id)
+	switch {
+	case value.Type().AssignableTo(field.Type()):
+		field.Set(value)
+	case field.Kind() == reflect.Pointer && value.Type().AssignableTo(field.Type().Elem()):
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(value)
+		field.Set(ptr)
+	}
+}
+
+// marshalWithID encodes doc and returns it together with its _id,
+// generating an ObjectID first when the document has none, the same way the driver does on insert.
+// Knowing the ids up front tells which documents of a failed batch were inserted.
+// doc is left untouched, callers decide when to assign a generated id with setID.
+func marshalWithID(doc any) (bson.Raw, any, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if value, err := bson.Raw(raw).LookupErr("_id"); err == nil {
+		var id any
+		if err = value.Unmarshal(&id); err != nil {
+			return nil, nil, err
+		}
+		return raw, id, nil
+	}
+
+	id := primitive.NewObjectID()
+
+	idx, withID := bsoncore.AppendDocumentStart(nil)
+	withID = bsoncore.AppendObjectIDElement(withID, "_id", id)
+	withID = append(withID, raw[4:len(raw)-1]...)
+	withID, err = bsoncore.AppendDocumentEnd(withID, idx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return withID, id, nil
+}
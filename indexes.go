@@ -0,0 +1,36 @@
+package mongokit
+
+import (
+	"context"
+	"github.com/dinson/mongokit/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+)
+
+func (r repositoryImpl[T]) EnsureIndexes(ctx context.Context) error {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	var models []mongo.IndexModel
+
+	for _, field := range utils.BSONFields(reflect.TypeOf((*T)(nil)).Elem()) {
+		if tagOptions(field)[tag2DSphere] {
+			models = append(models, mongo.IndexModel{
+				Keys: bson.D{{field.Path, tag2DSphere}},
+			})
+		}
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	collection, err := r.resolve(newCtx)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateMany(newCtx, models)
+	return err
+}
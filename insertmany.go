@@ -6,30 +6,28 @@ import (
 )
 
 func (r repositoryImpl[T]) InsertMany(ctx context.Context, docs []*T) ([]*primitive.ObjectID, error) {
-	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
-	defer cancel()
-
-	var docInterfaceList []any
-
-	for _, d := range docs {
-		docInterfaceList = append(docInterfaceList, d)
-	}
-
-	res, err := r.collection.InsertMany(newCtx, docInterfaceList)
-	if err != nil {
+	res, err := r.InsertManyChunked(ctx, docs, &InsertManyOptions{Ordered: true})
+	if res == nil {
 		return nil, err
 	}
 
-	insertedIDs := res.InsertedIDs
+	return insertedObjectIDs(res, err)
+}
+
+// insertedObjectIDs returns the ObjectIDs of the inserted documents in input order, without the documents that were not inserted
+func insertedObjectIDs(res *InsertManyResult, err error) ([]*primitive.ObjectID, error) {
+	objectIDs, idErr := res.ObjectIDs()
+	if err == nil {
+		err = idErr
+	}
 
 	var primitiveIDs []*primitive.ObjectID
 
-	for _, i := range insertedIDs {
-		if i != nil {
-			primitiveOID := i.(primitive.ObjectID)
-			primitiveIDs = append(primitiveIDs, &primitiveOID)
+	for _, oid := range objectIDs {
+		if oid != nil {
+			primitiveIDs = append(primitiveIDs, oid)
 		}
 	}
 
-	return primitiveIDs, nil
+	return primitiveIDs, err
 }
@@ -0,0 +1,210 @@
+package mongokit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultChunkSize     = 1000
+	defaultMaxChunkBytes = 16 * 1024 * 1024
+)
+
+type InsertManyOptions struct {
+	// ChunkSize is the maximum number of documents sent in a single insert call. Defaults to 1000.
+	ChunkSize int
+	// MaxChunkBytes is the maximum encoded size of the documents sent in a single insert call. Defaults to 16MB.
+	// A document bigger than the limit is sent on its own.
+	MaxChunkBytes int
+	// Ordered inserts chunks one after the other and stops at the first failed document,
+	// the remaining documents are reported as not attempted.
+	// When false, every document is attempted and chunks may run concurrently.
+	Ordered bool
+	// Concurrency is the number of chunks inserted at the same time when not ordered. Defaults to 1.
+	Concurrency int
+	// ChunkTimeout bounds each insert call instead of the whole import. Defaults to 15 seconds.
+	ChunkTimeout time.Duration
+}
+
+type InsertManyResult struct {
+	// InsertedIDs holds the _id of every input document at its input index, nil when it was not inserted
+	InsertedIDs []any
+	// Failures maps the index of every document that was not inserted to the reason,
+	// a *WriteError for documents rejected by the server
+	Failures map[int]error
+}
+
+// FailedIndexes returns the sorted input indexes of the documents that were not inserted,
+// so that a failed import can be resumed with only those documents.
+func (r *InsertManyResult) FailedIndexes() []int {
+	indexes := make([]int, 0, len(r.Failures))
+	for i := range r.Failures {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (r repositoryImpl[T]) InsertManyChunked(ctx context.Context, docs []*T, opts *InsertManyOptions) (*InsertManyResult, error) {
+	o := InsertManyOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = defaultChunkSize
+	}
+	if o.MaxChunkBytes <= 0 {
+		o.MaxChunkBytes = defaultMaxChunkBytes
+	}
+	if o.Concurrency <= 0 || o.Ordered {
+		o.Concurrency = 1
+	}
+	if o.ChunkTimeout <= 0 {
+		o.ChunkTimeout = connectionTimeout
+	}
+
+	collection, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &InsertManyResult{
+		InsertedIDs: make([]any, len(docs)),
+		Failures:    map[int]error{},
+	}
+
+	raws := make([]bson.Raw, len(docs))
+	ids := make([]any, len(docs))
+
+	var chunks [][]int
+	var chunk []int
+	chunkBytes := 0
+
+	for i, doc := range docs {
+		raw, id, err := r.marshalDoc(ctx, doc)
+		if err != nil {
+			result.Failures[i] = err
+			if o.Ordered {
+				markNotAttempted(result, i+1, len(docs))
+				break
+			}
+			continue
+		}
+		raws[i], ids[i] = raw, id
+
+		if len(chunk) > 0 && (len(chunk) == o.ChunkSize || chunkBytes+len(raw) > o.MaxChunkBytes) {
+			chunks = append(chunks, chunk)
+			chunk, chunkBytes = nil, 0
+		}
+		chunk = append(chunk, i)
+		chunkBytes += len(raw)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, o.Concurrency)
+
+	for c, chunk := range chunks {
+		if ctx.Err() != nil {
+			mu.Lock()
+			for _, rest := range chunks[c:] {
+				for _, i := range rest {
+					result.Failures[i] = ctx.Err()
+				}
+			}
+			mu.Unlock()
+			break
+		}
+
+		if o.Ordered {
+			if failed := r.insertChunk(ctx, collection, chunk, raws, ids, o, result, &mu); failed {
+				for _, rest := range chunks[c+1:] {
+					for _, i := range rest {
+						result.Failures[i] = errNotAttempted
+					}
+				}
+				break
+			}
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(chunk []int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.insertChunk(ctx, collection, chunk, raws, ids, o, result, &mu)
+		}(chunk)
+	}
+	wg.Wait()
+
+	if len(result.Failures) > 0 {
+		return result, fmt.Errorf("%w: %d of %d documents were not inserted", errInsertManyFailed, len(result.Failures), len(docs))
+	}
+
+	return result, nil
+}
+
+// insertChunk inserts the documents at the given input indexes and records the outcome of each of them.
+// Returns true when at least one document was not inserted.
+func (r repositoryImpl[T]) insertChunk(ctx context.Context, collection *mongo.Collection, chunk []int, raws []bson.Raw, ids []any, o InsertManyOptions, result *InsertManyResult, mu *sync.Mutex) bool {
+	newCtx, cancel := context.WithTimeout(ctx, o.ChunkTimeout)
+	defer cancel()
+
+	docs := make([]any, 0, len(chunk))
+	for _, i := range chunk {
+		docs = append(docs, raws[i])
+	}
+
+	_, err := collection.InsertMany(newCtx, docs, options.InsertMany().SetOrdered(o.Ordered))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var exception mongo.BulkWriteException
+	if err != nil && !errors.As(err, &exception) {
+		// nothing tells which documents made it, report the whole chunk
+		for _, i := range chunk {
+			result.Failures[i] = err
+		}
+		return true
+	}
+
+	failedAt := len(chunk)
+	for _, we := range exception.WriteErrors {
+		i := chunk[we.Index]
+		result.Failures[i] = &WriteError{Index: i, Code: we.Code, Message: we.Message}
+		if we.Index < failedAt {
+			failedAt = we.Index
+		}
+	}
+
+	for pos, i := range chunk {
+		if _, failed := result.Failures[i]; failed {
+			continue
+		}
+		if o.Ordered && pos > failedAt {
+			result.Failures[i] = errNotAttempted
+			continue
+		}
+		result.InsertedIDs[i] = ids[i]
+	}
+
+	return len(exception.WriteErrors) > 0
+}
+
+func markNotAttempted(result *InsertManyResult, from, to int) {
+	for i := from; i < to; i++ {
+		result.Failures[i] = errNotAttempted
+	}
+}
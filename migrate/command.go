@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: migrate <command> [steps]
+
+commands:
+  up [n]     apply all pending migrations, or the next n
+  down [n]   roll back the last applied migration, or the last n
+  status     list migrations and whether they are applied
+`
+
+/*
+Command runs the migrate CLI against the migrator.
+
+Migrations are Go functions compiled into the binary, so the CLI is wired
+from the application's own main package:
+
+	func main() {
+		client, _ := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGODB_URI")))
+		m := migrate.New(client.Database("app"))
+		if err := m.Command(ctx, os.Args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+*/
+func (m *Migrator) Command(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(out, usage)
+		return nil
+	}
+
+	switch args[0] {
+	case "up":
+		steps, err := parseSteps(args[1:], 0)
+		if err != nil {
+			return err
+		}
+
+		applied, err := m.Up(ctx, steps)
+		for _, migration := range applied {
+			_, _ = fmt.Fprintf(out, "applied %d %s\n", migration.Version, migration.Description)
+		}
+		if err == nil && len(applied) == 0 {
+			_, _ = fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+
+	case "down":
+		steps, err := parseSteps(args[1:], 1)
+		if err != nil {
+			return err
+		}
+
+		rolledBack, err := m.Down(ctx, steps)
+		for _, migration := range rolledBack {
+			_, _ = fmt.Fprintf(out, "rolled back %d %s\n", migration.Version, migration.Description)
+		}
+		if err == nil && len(rolledBack) == 0 {
+			_, _ = fmt.Fprintln(out, "no applied migrations")
+		}
+		return err
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return printStatus(out, statuses)
+
+	case "help", "-h", "--help":
+		_, _ = fmt.Fprint(out, usage)
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", errUnknownCommand, args[0])
+}
+
+func parseSteps(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+
+	steps, err := strconv.Atoi(args[0])
+	if err != nil || steps < 1 {
+		return 0, fmt.Errorf("%w: %s", errInvalidSteps, args[0])
+	}
+
+	return steps, nil
+}
+
+func printStatus(out io.Writer, statuses []Status) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tDESCRIPTION")
+
+	for _, s := range statuses {
+		state := "pending"
+		if s.Applied {
+			state = "applied"
+		}
+		if !s.Registered {
+			state = "unknown"
+		}
+
+		appliedAt := "-"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, state, appliedAt, s.Description)
+	}
+
+	return w.Flush()
+}
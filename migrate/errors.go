@@ -0,0 +1,15 @@
+package migrate
+
+import "errors"
+
+var (
+	// ErrLocked is returned when another runner currently holds the migration lock.
+	ErrLocked = errors.New("MIGRATION_LOCKED")
+
+	errDuplicateVersion = errors.New("DUPLICATE_MIGRATION_VERSION")
+	errInvalidVersion   = errors.New("INVALID_MIGRATION_VERSION")
+	errMissingUp        = errors.New("MIGRATION_UP_NOT_DEFINED")
+	errIrreversible     = errors.New("MIGRATION_DOWN_NOT_DEFINED")
+	errUnknownCommand   = errors.New("UNKNOWN_MIGRATE_COMMAND")
+	errInvalidSteps     = errors.New("INVALID_MIGRATE_STEPS")
+)
@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"time"
+)
+
+// lockID is the _id of the lock document stored alongside the migration records
+const lockID = "lock"
+
+// acquire takes the runner lock.
+//
+// The lock document is upserted only when it is free or its previous holder let it expire,
+// otherwise the upsert collides with the existing document and ErrLocked is returned.
+func (m *Migrator) acquire(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	filter := bson.D{
+		{"_id", lockID},
+		{"$or", bson.A{
+			bson.D{{"locked", false}},
+			bson.D{{"expiresAt", bson.D{{"$lt", now}}}},
+		}},
+	}
+	update := bson.D{{"$set", bson.D{
+		{"locked", true},
+		{"owner", m.owner},
+		{"lockedAt", now},
+		{"expiresAt", now.Add(m.lockTTL)},
+	}}}
+
+	_, err := m.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+
+	return err
+}
+
+// release frees the runner lock if it is still held by this migrator
+func (m *Migrator) release(ctx context.Context) error {
+	filter := bson.D{{"_id", lockID}, {"owner", m.owner}}
+	update := bson.D{{"$set", bson.D{{"locked", false}}}}
+
+	_, err := m.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func() error) (err error) {
+	if err = m.acquire(ctx); err != nil {
+		return err
+	}
+
+	defer func() {
+		// release with a fresh context so that a cancelled run still frees the lock
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 15*time.Second)
+		defer cancel()
+
+		if releaseErr := m.release(releaseCtx); releaseErr != nil {
+			log.Println(releaseErr)
+			err = errors.Join(err, releaseErr)
+		}
+	}()
+
+	return fn()
+}
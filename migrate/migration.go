@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"sync"
+)
+
+// Func is a single migration step executed against the database.
+type Func func(ctx context.Context, db *mongo.Database) error
+
+// Migration is a versioned change to the database.
+//
+// Versions must be unique and positive, and are applied in ascending order.
+// A common convention is to use a timestamp such as 20240131120000.
+type Migration struct {
+	Version     int64
+	Description string
+	Up          Func
+	Down        Func // optional, a migration without Down cannot be rolled back
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[int64]Migration{}
+)
+
+/*
+		Register adds a migration to the package level registry used by New.
+
+		It is meant to be called from an init function and panics on invalid or duplicate versions,
+		the same way database/sql.Register does.
+
+	 	Example usage:
+
+		func init() {
+			migrate.Register(20240131120000, "add users email index", upFn, downFn)
+		}
+*/
+func Register(version int64, description string, up, down Func) {
+	m := Migration{
+		Version:     version,
+		Description: description,
+		Up:          up,
+		Down:        down,
+	}
+
+	if err := m.validate(); err != nil {
+		panic(err)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[version]; ok {
+		panic(fmt.Errorf("%w: %d", errDuplicateVersion, version))
+	}
+	registry[version] = m
+}
+
+// Registered returns all migrations added with Register, sorted by version.
+func Registered() []Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	migrations := make([]Migration, 0, len(registry))
+	for _, m := range registry {
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations
+}
+
+func (m Migration) validate() error {
+	if m.Version <= 0 {
+		return fmt.Errorf("%w: %d", errInvalidVersion, m.Version)
+	}
+	if m.Up == nil {
+		return fmt.Errorf("%w: %d", errMissingUp, m.Version)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"github.com/dinson/mongokit"
+	"github.com/dinson/mongokit/querybuilder"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// CollectionName is the collection used to record applied migrations and the runner lock.
+	CollectionName = "_migrations"
+
+	defaultLockTTL = 10 * time.Minute
+)
+
+type record struct {
+	ID          *primitive.ObjectID `bson:"_id,omitempty"`
+	Version     int64               `bson:"version"`
+	Description string              `bson:"description"`
+	AppliedAt   time.Time           `bson:"appliedAt"`
+}
+
+// Status describes the state of a single migration.
+type Status struct {
+	Version     int64
+	Description string
+	Applied     bool
+	AppliedAt   *time.Time
+	// Registered is false when the migration is recorded in the database
+	// but no longer known to the running binary.
+	Registered bool
+}
+
+type Migrator struct {
+	db         *mongo.Database
+	collection *mongo.Collection
+	records    mongokit.Repository[record]
+	migrations []Migration
+	owner      string
+	lockTTL    time.Duration
+}
+
+/*
+		New creates a migrator for the given database.
+
+		If no migrations are passed, the migrations added with Register are used.
+
+	 	Example usage:
+
+		m := migrate.New(client.Database("app"))
+		applied, err := m.Up(ctx, 0)
+*/
+func New(db *mongo.Database, migrations ...Migration) *Migrator {
+	if len(migrations) == 0 {
+		migrations = Registered()
+	}
+
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	hostname, _ := os.Hostname()
+	collection := db.Collection(CollectionName)
+
+	return &Migrator{
+		db:         db,
+		collection: collection,
+		records:    mongokit.NewRepository[record](collection),
+		migrations: sorted,
+		owner:      fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()),
+		lockTTL:    defaultLockTTL,
+	}
+}
+
+// LockTTL sets how long the runner lock is held before it is considered stale
+// and may be taken over by another runner. Defaults to 10 minutes.
+func (m *Migrator) LockTTL(ttl time.Duration) *Migrator {
+	if ttl > 0 {
+		m.lockTTL = ttl
+	}
+	return m
+}
+
+// Up applies pending migrations in ascending version order.
+// If steps is 0 or negative, all pending migrations are applied.
+//
+// Returns the migrations that were applied.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	err := m.withLock(ctx, func() error {
+		records, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+			if _, ok := records[migration.Version]; ok {
+				continue
+			}
+
+			if err = migration.Up(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d up: %w", migration.Version, err)
+			}
+
+			rec := &record{
+				Version:     migration.Version,
+				Description: migration.Description,
+				AppliedAt:   time.Now().UTC(),
+			}
+			if _, err = m.records.Save(ctx, rec, nil); err != nil {
+				return fmt.Errorf("migration %d record: %w", migration.Version, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back applied migrations in descending version order.
+// If steps is 0 or negative, every applied migration is rolled back.
+//
+// Returns the migrations that were rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	var rolledBack []Migration
+
+	err := m.withLock(ctx, func() error {
+		records, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+
+			if steps > 0 && len(rolledBack) == steps {
+				break
+			}
+			if _, ok := records[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == nil {
+				return fmt.Errorf("%w: %d", errIrreversible, migration.Version)
+			}
+
+			if err = migration.Down(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d down: %w", migration.Version, err)
+			}
+
+			query, err := querybuilder.New().Where(querybuilder.Eq("version", migration.Version)).Build()
+			if err != nil {
+				return err
+			}
+			if err = m.records.DeleteOne(ctx, query); err != nil {
+				return fmt.Errorf("migration %d record: %w", migration.Version, err)
+			}
+
+			rolledBack = append(rolledBack, migration)
+		}
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status lists every known migration, together with recorded migrations
+// that are no longer registered, sorted by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	records, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+
+	for _, migration := range m.migrations {
+		s := Status{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Registered:  true,
+		}
+		if rec, ok := records[migration.Version]; ok {
+			appliedAt := rec.AppliedAt
+			s.Applied = true
+			s.AppliedAt = &appliedAt
+			delete(records, migration.Version)
+		}
+		statuses = append(statuses, s)
+	}
+
+	for _, rec := range records {
+		appliedAt := rec.AppliedAt
+		statuses = append(statuses, Status{
+			Version:     rec.Version,
+			Description: rec.Description,
+			Applied:     true,
+			AppliedAt:   &appliedAt,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// applied returns the recorded migrations keyed by version
+func (m *Migrator) applied(ctx context.Context) (map[int64]*record, error) {
+	query, err := querybuilder.New().Exists("version").SortAsc("version").Build()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := m.records.FindAll(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make(map[int64]*record, len(records))
+	for _, rec := range records {
+		resp[rec.Version] = rec
+	}
+
+	return resp, nil
+}
+
+func (m *Migrator) validate() error {
+	seen := make(map[int64]struct{}, len(m.migrations))
+	for _, migration := range m.migrations {
+		if err := migration.validate(); err != nil {
+			return err
+		}
+		if _, ok := seen[migration.Version]; ok {
+			return fmt.Errorf("%w: %d", errDuplicateVersion, migration.Version)
+		}
+		seen[migration.Version] = struct{}{}
+	}
+	return nil
+}
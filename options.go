@@ -0,0 +1,21 @@
+package mongokit
+
+// Option configures optional behaviour of a repository
+type Option func(r *repositoryConfig)
+
+type repositoryConfig struct {
+	strict         bool
+	keys           KeyProvider
+	related        RelatedCollectionResolver
+	populate       bool
+	populateFields []string
+}
+
+// WithStrictQueries makes the repository validate every query against the bson fields of T
+// before running it, failing with a *querybuilder.ValidationError that lists unknown fields
+// and type mismatches instead of silently matching nothing.
+func WithStrictQueries() Option {
+	return func(r *repositoryConfig) {
+		r.strict = true
+	}
+}
@@ -0,0 +1,171 @@
+// Package outbox implements the transactional outbox pattern on top of mongokit repositories.
+//
+// Domain events are written to an outbox collection in the same transaction as the repository write,
+// and a Relay dispatches them to a Publisher afterwards, so that no event is lost when the process
+// crashes between the write and the publish. Transactions require a replica set or a sharded cluster.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dinson/mongokit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+const (
+	// CollectionName is the default outbox collection
+	CollectionName = "outbox"
+
+	connectionTimeout = 15 * time.Second
+)
+
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusProcessing Status = "processing"
+	StatusSent       Status = "sent"
+	StatusFailed     Status = "failed" // gave up after the maximum number of attempts
+)
+
+type Event struct {
+	ID            *primitive.ObjectID `bson:"_id,omitempty"`
+	Topic         string              `bson:"topic"`
+	Key           string              `bson:"key,omitempty"`
+	Payload       []byte              `bson:"payload"`
+	Headers       map[string]string   `bson:"headers,omitempty"`
+	Status        Status              `bson:"status"`
+	Attempts      int                 `bson:"attempts"`
+	LastError     string              `bson:"lastError,omitempty"`
+	NextAttemptAt time.Time           `bson:"nextAttemptAt"`
+	ClaimedBy     string              `bson:"claimedBy,omitempty"`
+	ClaimedUntil  *time.Time          `bson:"claimedUntil,omitempty"`
+	CreatedAt     time.Time           `bson:"createdAt"`
+	SentAt        *time.Time          `bson:"sentAt,omitempty"`
+}
+
+// NewEvent creates an event whose payload is the JSON encoding of payload
+func NewEvent(topic, key string, payload any) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Topic:   topic,
+		Key:     key,
+		Payload: data,
+	}, nil
+}
+
+type Outbox struct {
+	collection *mongo.Collection
+}
+
+// New creates an outbox stored in the "outbox" collection of db
+func New(db *mongo.Database) *Outbox {
+	return NewWithCollection(db.Collection(CollectionName))
+}
+
+// NewWithCollection creates an outbox stored in collection
+func NewWithCollection(collection *mongo.Collection) *Outbox {
+	return &Outbox{
+		collection: collection,
+	}
+}
+
+/*
+		Transaction runs fn in a transaction. Repository writes and Enqueue calls made with
+		the context passed to fn are committed or aborted together.
+
+		fn may be retried by the driver on transient errors and must be idempotent.
+
+	 	Example usage:
+
+		err := ob.Transaction(ctx, func(ctx context.Context) error {
+			if _, err := ordersRepo.Save(ctx, order, nil); err != nil {
+				return err
+			}
+			event, err := outbox.NewEvent("orders.created", order.ID.Hex(), order)
+			if err != nil {
+				return err
+			}
+			return ob.Enqueue(ctx, event)
+		})
+*/
+func (o *Outbox) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := o.collection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.WithoutCancel(ctx))
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (any, error) {
+		return nil, fn(sessCtx)
+	})
+
+	return err
+}
+
+// Enqueue writes events to the outbox as pending.
+// Call it with the context of a Transaction so that events are only stored when the writes are.
+func (o *Outbox) Enqueue(ctx context.Context, events ...*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	docs := make([]any, 0, len(events))
+
+	for _, event := range events {
+		if event.ID == nil {
+			id := primitive.NewObjectID()
+			event.ID = &id
+		}
+		event.Status = StatusPending
+		event.Attempts = 0
+		event.CreatedAt = now
+		event.NextAttemptAt = now
+		docs = append(docs, event)
+	}
+
+	_, err := o.collection.InsertMany(newCtx, docs)
+	return err
+}
+
+// SaveWithEvents saves entity with repo and enqueues events in a single transaction.
+func SaveWithEvents[T any](ctx context.Context, o *Outbox, repo mongokit.Repository[T], entity *T, ID *string, events ...*Event) (*primitive.ObjectID, error) {
+	var savedID *primitive.ObjectID
+
+	err := o.Transaction(ctx, func(ctx context.Context) error {
+		id, err := repo.Save(ctx, entity, ID)
+		if err != nil {
+			return err
+		}
+		savedID = id
+
+		return o.Enqueue(ctx, events...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return savedID, nil
+}
+
+// EnsureIndexes creates the index used by relays to claim due events
+func (o *Outbox) EnsureIndexes(ctx context.Context) error {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	_, err := o.collection.Indexes().CreateOne(newCtx, mongo.IndexModel{
+		Keys: bson.D{{"status", 1}, {"nextAttemptAt", 1}},
+	})
+	return err
+}
@@ -0,0 +1,209 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"time"
+)
+
+const (
+	defaultBatchSize    = 100
+	defaultPollInterval = time.Second
+	defaultClaimTTL     = 30 * time.Second
+	defaultMaxAttempts  = 10
+	maxBackoff          = 5 * time.Minute
+)
+
+// Publisher dispatches events to a message broker or any other destination.
+// Publish must return an error when the event was not delivered, so that it is retried.
+type Publisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+type RelayOptions struct {
+	// WorkerID identifies the relay in claimed events. Defaults to the hostname, process id and a random suffix.
+	WorkerID string
+	// BatchSize is the maximum number of events dispatched per poll. Defaults to 100.
+	BatchSize int
+	// PollInterval is the wait between polls when no event is due. Defaults to 1 second.
+	PollInterval time.Duration
+	// ClaimTTL is how long a claimed event is reserved for this relay before other relays may take it over,
+	// e.g. when this relay crashed while publishing. Defaults to 30 seconds.
+	ClaimTTL time.Duration
+	// MaxAttempts is the number of failed publishes after which an event is marked as failed. Defaults to 10.
+	MaxAttempts int
+	// Backoff returns the wait before the next attempt of an event that failed attempts times.
+	// Defaults to exponential backoff from 1 second up to 5 minutes.
+	Backoff func(attempts int) time.Duration
+	// OnError is called with the errors of the batches run by Run, which keeps polling after them.
+	// Errors are dropped when nil.
+	OnError func(err error)
+}
+
+// Relay claims due events from the outbox, dispatches them to a Publisher and marks them as sent.
+// Several relays can run concurrently against the same outbox, each event is claimed by one of them.
+// Delivery is at least once: an event may be published again if the relay crashes after publishing.
+type Relay struct {
+	outbox    *Outbox
+	publisher Publisher
+	opts      RelayOptions
+}
+
+func NewRelay(o *Outbox, publisher Publisher, opts *RelayOptions) *Relay {
+	r := &Relay{
+		outbox:    o,
+		publisher: publisher,
+	}
+	if opts != nil {
+		r.opts = *opts
+	}
+
+	if r.opts.WorkerID == "" {
+		hostname, _ := os.Hostname()
+		r.opts.WorkerID = fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), primitive.NewObjectID().Hex())
+	}
+	if r.opts.BatchSize <= 0 {
+		r.opts.BatchSize = defaultBatchSize
+	}
+	if r.opts.PollInterval <= 0 {
+		r.opts.PollInterval = defaultPollInterval
+	}
+	if r.opts.ClaimTTL <= 0 {
+		r.opts.ClaimTTL = defaultClaimTTL
+	}
+	if r.opts.MaxAttempts <= 0 {
+		r.opts.MaxAttempts = defaultMaxAttempts
+	}
+	if r.opts.Backoff == nil {
+		r.opts.Backoff = exponentialBackoff
+	}
+
+	return r
+}
+
+// Run dispatches events until ctx is done. Errors of a batch are reported to RelayOptions.OnError.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.ProcessBatch(ctx)
+		if err != nil && ctx.Err() == nil && r.opts.OnError != nil {
+			r.opts.OnError(err)
+		}
+
+		if n > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.opts.PollInterval):
+		}
+	}
+}
+
+// ProcessBatch dispatches up to BatchSize due events and returns how many were claimed
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	for n := 0; n < r.opts.BatchSize; n++ {
+		event, err := r.claim(ctx)
+		if err != nil {
+			return n, err
+		}
+		if event == nil {
+			return n, nil
+		}
+
+		if err = r.dispatch(ctx, event); err != nil {
+			return n + 1, err
+		}
+	}
+
+	return r.opts.BatchSize, nil
+}
+
+// claim reserves the oldest due event for this relay, including events whose previous claim expired
+func (r *Relay) claim(ctx context.Context) (*Event, error) {
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	filter := bson.D{{"$or", bson.A{
+		bson.D{{"status", StatusPending}, {"nextAttemptAt", bson.D{{"$lte", now}}}},
+		bson.D{{"status", StatusProcessing}, {"claimedUntil", bson.D{{"$lt", now}}}},
+	}}}
+	update := bson.D{{"$set", bson.D{
+		{"status", StatusProcessing},
+		{"claimedBy", r.opts.WorkerID},
+		{"claimedUntil", now.Add(r.opts.ClaimTTL)},
+	}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{"nextAttemptAt", 1}}).
+		SetReturnDocument(options.After)
+
+	var event Event
+	err := r.outbox.collection.FindOneAndUpdate(newCtx, filter, update, opts).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// dispatch publishes a claimed event and records the outcome
+func (r *Relay) dispatch(ctx context.Context, event *Event) error {
+	publishCtx, cancel := context.WithTimeout(ctx, r.opts.ClaimTTL)
+	publishErr := r.publisher.Publish(publishCtx, event)
+	cancel()
+
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter := bson.D{{"_id", event.ID}, {"claimedBy", r.opts.WorkerID}}
+
+	var update bson.D
+	if publishErr == nil {
+		update = bson.D{
+			{"$set", bson.D{{"status", StatusSent}, {"sentAt", now}}},
+			{"$unset", bson.D{{"claimedBy", ""}, {"claimedUntil", ""}, {"lastError", ""}}},
+		}
+	} else {
+		attempts := event.Attempts + 1
+		status := StatusPending
+		if attempts >= r.opts.MaxAttempts {
+			status = StatusFailed
+		}
+		update = bson.D{
+			{"$set", bson.D{
+				{"status", status},
+				{"attempts", attempts},
+				{"lastError", publishErr.Error()},
+				{"nextAttemptAt", now.Add(r.opts.Backoff(attempts))},
+			}},
+			{"$unset", bson.D{{"claimedBy", ""}, {"claimedUntil", ""}}},
+		}
+	}
+
+	_, err := r.outbox.collection.UpdateOne(newCtx, filter, update)
+	return err
+}
+
+func exponentialBackoff(attempts int) time.Duration {
+	backoff := time.Second
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
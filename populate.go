@@ -0,0 +1,391 @@
+package mongokit
+
+import (
+	"context"
+	"fmt"
+	"github.com/dinson/mongokit/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const refTagName = "ref"
+
+// refField is a field of T filled from another collection, declared with the ref struct tag
+type refField struct {
+	name         string // Go field name
+	index        []int
+	collection   string
+	localIndex   []int
+	foreignField string
+	elem         reflect.Type // struct type of the related model
+	many         bool         // slice field
+	pointer      bool         // field, or its elements, are pointers to elem
+}
+
+var refCache sync.Map // map[reflect.Type][]refField
+
+// WithPopulate makes FindAll and FindOne populate the ref fields of their results, see Repository.Populate.
+// Pass Go field names to populate only some of them, every ref field is populated otherwise.
+func WithPopulate(fields ...string) Option {
+	return func(r *repositoryConfig) {
+		r.populate = true
+		r.populateFields = fields
+	}
+}
+
+// autoPopulater is implemented by repositories whose finds populate their results, see WithPopulate
+type autoPopulater interface {
+	autoPopulates() bool
+}
+
+func (r repositoryImpl[T]) autoPopulates() bool {
+	return r.config.populate
+}
+
+// populateResults populates docs when the repository was created WithPopulate
+func (r repositoryImpl[T]) populateResults(ctx context.Context, docs []*T) error {
+	if !r.config.populate || len(docs) == 0 {
+		return nil
+	}
+	return r.Populate(ctx, docs, r.config.populateFields...)
+}
+
+func (r repositoryImpl[T]) Populate(ctx context.Context, docs []*T, fields ...string) error {
+	refs, err := refFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		refs, err = selectRefs(refs, fields)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(docs) == 0 || len(refs) == 0 {
+		return nil
+	}
+
+	if r.config.related == nil {
+		return errUnresolvedRelated
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	for _, ref := range refs {
+		collection, err := r.config.related(newCtx, ref.collection)
+		if err != nil {
+			return err
+		}
+		if err = r.populate(newCtx, collection, docs, ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// populate fills one ref field of every document with a single $in query on the related collection
+func (r repositoryImpl[T]) populate(ctx context.Context, collection *mongo.Collection, docs []*T, ref refField) error {
+	locals, values := localKeys(docs, ref)
+	if len(values) == 0 {
+		return nil
+	}
+
+	filter := bson.D{{ref.foreignField, bson.D{{"$in", values}}}}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	related := map[string][]reflect.Value{}
+	var items []reflect.Value
+	for cursor.Next(ctx) {
+		item, err := addRelated(related, ref, cursor.Current)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+
+	// related models are decrypted with the keys of the repository
+	if err = decryptStructs(ctx, r.config.keys, ref.elem, items); err != nil {
+		return err
+	}
+
+	fillRefs(docs, ref, locals, related)
+	return nil
+}
+
+// localKeys returns the keys of the local field values of every document, and the distinct values to query
+func localKeys[T any](docs []*T, ref refField) ([][]string, bson.A) {
+	var values bson.A
+	seen := map[string]bool{}
+
+	locals := make([][]string, len(docs))
+	for i, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		for _, v := range localValues(reflect.ValueOf(doc).Elem(), ref.localIndex) {
+			key, ok := valueKey(v)
+			if !ok {
+				continue
+			}
+			locals[i] = append(locals[i], key)
+			if !seen[key] {
+				seen[key] = true
+				values = append(values, v)
+			}
+		}
+	}
+
+	return locals, values
+}
+
+// addRelated decodes a related document and indexes it by the keys of its foreign field
+func addRelated(related map[string][]reflect.Value, ref refField, raw bson.Raw) (reflect.Value, error) {
+	item := reflect.New(ref.elem)
+	if err := bson.Unmarshal(raw, item.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+
+	if foreign, err := raw.LookupErr(strings.Split(ref.foreignField, ".")...); err == nil {
+		for _, key := range rawValueKeys(foreign) {
+			related[key] = append(related[key], item)
+		}
+	}
+
+	return item, nil
+}
+
+// fillRefs sets the ref field of every document to its related documents
+func fillRefs[T any](docs []*T, ref refField, locals [][]string, related map[string][]reflect.Value) {
+	for i, doc := range docs {
+		if doc == nil {
+			continue
+		}
+
+		var matches []reflect.Value
+		for _, key := range locals[i] {
+			matches = append(matches, related[key]...)
+		}
+
+		target := reflect.ValueOf(doc).Elem().FieldByIndex(ref.index)
+		target.Set(reflect.Zero(target.Type()))
+
+		if len(matches) == 0 {
+			continue
+		}
+
+		if !ref.many {
+			target.Set(element(matches[0], ref.pointer))
+			continue
+		}
+
+		slice := reflect.MakeSlice(target.Type(), 0, len(matches))
+		for _, m := range matches {
+			slice = reflect.Append(slice, element(m, ref.pointer))
+		}
+		target.Set(slice)
+	}
+}
+
+// refFields parses the ref struct tags of t, e.g.
+//
+//	Author *User `bson:"-" ref:"users,localField=authorId"`
+//
+// foreignField defaults to _id.
+func refFields(t reflect.Type) ([]refField, error) {
+	if cached, ok := refCache.Load(t); ok {
+		return cached.([]refField), nil
+	}
+
+	localFields := map[string]utils.Field{}
+	for _, f := range utils.BSONFields(t) {
+		if f.Index != nil {
+			localFields[f.Path] = f
+		}
+	}
+
+	var refs []refField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup(refTagName)
+		if !ok || !sf.IsExported() {
+			continue
+		}
+		if sf.Tag.Get("bson") != "-" {
+			// a ref field is filled by Populate and must not be written with the document
+			return nil, fmt.Errorf("%w: %s.%s: ref fields must be tagged bson:\"-\"", errInvalidRefTag, t.Name(), sf.Name)
+		}
+
+		ref := refField{
+			name:         sf.Name,
+			index:        sf.Index,
+			foreignField: "_id",
+		}
+
+		parts := strings.Split(tag, ",")
+		ref.collection = strings.TrimSpace(parts[0])
+
+		var localField string
+		for _, part := range parts[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch k {
+			case "localField":
+				localField = v
+			case "foreignField":
+				ref.foreignField = v
+			default:
+				return nil, fmt.Errorf("%w: %s.%s: unknown option %q", errInvalidRefTag, t.Name(), sf.Name, k)
+			}
+		}
+
+		if ref.collection == "" || localField == "" || ref.foreignField == "" {
+			return nil, fmt.Errorf("%w: %s.%s: collection and localField are required", errInvalidRefTag, t.Name(), sf.Name)
+		}
+
+		local, ok := localFields[localField]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s.%s: unknown localField %q", errInvalidRefTag, t.Name(), sf.Name, localField)
+		}
+		ref.localIndex = local.Index
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Slice {
+			ref.many = true
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Pointer {
+			ref.pointer = true
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%w: %s.%s: field must be a struct, a pointer to a struct or a slice of them", errInvalidRefTag, t.Name(), sf.Name)
+		}
+		ref.elem = ft
+
+		refs = append(refs, ref)
+	}
+
+	cached, _ := refCache.LoadOrStore(t, refs)
+	return cached.([]refField), nil
+}
+
+func selectRefs(refs []refField, fields []string) ([]refField, error) {
+	var selected []refField
+	for _, name := range fields {
+		found := false
+		for _, ref := range refs {
+			if ref.name == name {
+				selected = append(selected, ref)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", errUnknownRefField, name)
+		}
+	}
+	return selected, nil
+}
+
+// localValues returns the value of the local field, or its elements when it is an array of references
+func localValues(doc reflect.Value, index []int) []any {
+	v, err := doc.FieldByIndexErr(index)
+	if err != nil {
+		return nil // nil pointer on the way to the field
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type() != reflect.TypeOf(primitive.ObjectID{}) && v.Type().Elem().Kind() != reflect.Uint8 {
+			values := make([]any, 0, v.Len())
+			for i := 0; i < v.Len(); i++ {
+				values = append(values, v.Index(i).Interface())
+			}
+			return values
+		}
+	}
+
+	return []any{v.Interface()}
+}
+
+// valueKey returns a comparable key of the bson encoding of a value, see rawKey
+func valueKey(v any) (string, bool) {
+	t, data, err := bson.MarshalValue(v)
+	if err != nil || t == bson.TypeNull {
+		return "", false
+	}
+	return rawKey(bson.RawValue{Type: t, Value: data}), true
+}
+
+// rawKey returns a comparable key of a bson value. Numbers of equal value have the same key
+// whatever their type, the way MongoDB matches them, e.g. int32 5, int64 5 and double 5.0.
+func rawKey(v bson.RawValue) string {
+	number := string(rune(bson.TypeDouble))
+
+	switch v.Type {
+	case bson.TypeInt32:
+		return number + strconv.FormatInt(int64(v.Int32()), 10)
+	case bson.TypeInt64:
+		return number + strconv.FormatInt(v.Int64(), 10)
+	case bson.TypeDouble:
+		f := v.Double()
+		if f == math.Trunc(f) && math.Abs(f) < math.MaxInt64 {
+			return number + strconv.FormatInt(int64(f), 10)
+		}
+		return number + strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	return string(rune(v.Type)) + string(v.Value)
+}
+
+// rawValueKeys returns the keys of a foreign field value, one per element for arrays
+func rawValueKeys(v bson.RawValue) []string {
+	if v.Type != bson.TypeArray {
+		return []string{rawKey(v)}
+	}
+
+	values, err := v.Array().Values()
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(values))
+	for _, item := range values {
+		keys = append(keys, rawKey(item))
+	}
+	return keys
+}
+
+func element(item reflect.Value, pointer bool) reflect.Value {
+	if pointer {
+		return item
+	}
+	return item.Elem()
+}
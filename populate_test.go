@@ -0,0 +1,142 @@
+package mongokit
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type populateAuthor struct {
+	ID    int64  `bson:"_id"`
+	Name  string `bson:"name"`
+	Email string `bson:"email" mongokit:"encrypt"`
+}
+
+type populateComment struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	PostID int32              `bson:"postId"`
+}
+
+type populatePost struct {
+	ID       int32              `bson:"_id"`
+	AuthorID int32              `bson:"authorId"`
+	Author   *populateAuthor    `bson:"-" ref:"authors,localField=authorId"`
+	Comments []*populateComment `bson:"-" ref:"comments,localField=_id,foreignField=postId"`
+}
+
+func TestValueKeyMatchesNumbersOfEqualValue(t *testing.T) {
+	int32Key, _ := valueKey(int32(5))
+	int64Key, _ := valueKey(int64(5))
+	doubleKey, _ := valueKey(5.0)
+	if int32Key != int64Key || int32Key != doubleKey {
+		t.Errorf("keys of 5 differ: %q, %q, %q", int32Key, int64Key, doubleKey)
+	}
+
+	fractionKey, _ := valueKey(5.5)
+	stringKey, _ := valueKey("5")
+	if fractionKey == int32Key || stringKey == int32Key {
+		t.Error("different values have the same key")
+	}
+
+	if _, ok := valueKey(nil); ok {
+		t.Error("null has a key")
+	}
+}
+
+func TestPopulateMatchesNumericTypes(t *testing.T) {
+	refs, err := refFields(reflect.TypeOf(populatePost{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, comments := refs[0], refs[1]
+
+	posts := []*populatePost{{ID: 1, AuthorID: 7}, {ID: 2, AuthorID: 8}, nil}
+
+	// authors ids are stored as int64 and doubles, the local field is an int32
+	authors := map[string][]reflect.Value{}
+	for _, doc := range []bson.D{{{"_id", int64(7)}, {"name", "Ann"}}, {{"_id", 8.0}, {"name", "Bob"}}} {
+		raw, _ := bson.Marshal(doc)
+		if _, err = addRelated(authors, author, raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	locals, values := localKeys(posts, author)
+	if len(values) != 2 {
+		t.Fatalf("got %d values to query, want 2", len(values))
+	}
+	fillRefs(posts, author, locals, authors)
+
+	if posts[0].Author == nil || posts[0].Author.Name != "Ann" || posts[1].Author == nil || posts[1].Author.Name != "Bob" {
+		t.Errorf("authors not populated: %+v, %+v", posts[0].Author, posts[1].Author)
+	}
+
+	related := map[string][]reflect.Value{}
+	for _, doc := range []bson.D{
+		{{"_id", primitive.NewObjectID()}, {"postId", int64(1)}},
+		{{"_id", primitive.NewObjectID()}, {"postId", int64(1)}},
+		{{"_id", primitive.NewObjectID()}, {"postId", int64(3)}},
+	} {
+		raw, _ := bson.Marshal(doc)
+		if _, err = addRelated(related, comments, raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	locals, _ = localKeys(posts, comments)
+	fillRefs(posts, comments, locals, related)
+
+	if len(posts[0].Comments) != 2 || posts[1].Comments != nil {
+		t.Errorf("got %d and %d comments, want 2 and 0", len(posts[0].Comments), len(posts[1].Comments))
+	}
+}
+
+func TestPopulateDecryptsRelatedDocuments(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys("k1", "k1")
+
+	encrypted, err := encryptDoc(ctx, keys, &populateAuthor{ID: 7, Email: "ann@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := refFields(reflect.TypeOf(populatePost{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := bson.Marshal(encrypted)
+	item, err := addRelated(map[string][]reflect.Value{}, refs[0], raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = decryptStructs(ctx, keys, refs[0].elem, []reflect.Value{item}); err != nil {
+		t.Fatal(err)
+	}
+	if got := item.Interface().(*populateAuthor).Email; got != "ann@example.com" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRefFieldsValidation(t *testing.T) {
+	type stored struct {
+		AuthorID int32           `bson:"authorId"`
+		Author   *populateAuthor `bson:"author" ref:"authors,localField=authorId"`
+	}
+	type unknownLocal struct {
+		Author *populateAuthor `bson:"-" ref:"authors,localField=missing"`
+	}
+	type notStruct struct {
+		AuthorID int32  `bson:"authorId"`
+		Author   string `bson:"-" ref:"authors,localField=authorId"`
+	}
+
+	for name, model := range map[string]any{"bson": stored{}, "localField": unknownLocal{}, "struct": notStruct{}} {
+		_, err := refFields(reflect.TypeOf(model))
+		if !errors.Is(err, errInvalidRefTag) || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package querybuilder
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Group groups documents by id and computes the accumulators for each group.
+// id is an expression such as Ref("status"), a document of expressions, or nil to group every document.
+//
+// Example usage: revenue per status
+//
+//	querybuilder.New().Group(querybuilder.Ref("status"),
+//		querybuilder.Sum("revenue", querybuilder.Multiply(querybuilder.Ref("price"), querybuilder.Ref("qty"))),
+//		querybuilder.Sum("orders", 1),
+//	)
+func (b *QueryBuilder) Group(id any, accs ...Accumulator) *QueryBuilder {
+	group := append(bson.D{{"_id", id}}, accumulators(accs)...)
+	return b.addStage("$group", group)
+}
+
+// Project reshapes documents, keeping, removing or computing the given fields
+func (b *QueryBuilder) Project(fields ...FieldExpr) *QueryBuilder {
+	if len(fields) == 0 {
+		return b
+	}
+	return b.addStage("$project", fieldExpressions(fields))
+}
+
+// AddFields adds computed fields to documents, keeping all existing fields
+func (b *QueryBuilder) AddFields(fields ...FieldExpr) *QueryBuilder {
+	if len(fields) == 0 {
+		return b
+	}
+	return b.addStage("$addFields", fieldExpressions(fields))
+}
+
+// Unwind outputs a document for each element of the array field key.
+// opts is optional.
+func (b *QueryBuilder) Unwind(key KeyMongoDB, opts *UnwindOptions) *QueryBuilder {
+	if len(key.String()) == 0 {
+		return b
+	}
+
+	if opts == nil {
+		return b.addStage("$unwind", Ref(key))
+	}
+
+	unwind := bson.D{{"path", Ref(key)}}
+	if opts.IncludeArrayIndex != "" {
+		unwind = append(unwind, bson.E{"includeArrayIndex", opts.IncludeArrayIndex})
+	}
+	if opts.PreserveNullAndEmptyArrays {
+		unwind = append(unwind, bson.E{"preserveNullAndEmptyArrays", true})
+	}
+	return b.addStage("$unwind", unwind)
+}
+
+// Facet runs several sub pipelines on the same input documents, each output in its own field
+func (b *QueryBuilder) Facet(facets ...FacetModel) *QueryBuilder {
+	if len(facets) == 0 {
+		return b
+	}
+
+	facet := make(bson.D, 0, len(facets))
+	for _, f := range facets {
+		pipeline := f.Pipeline
+		if pipeline == nil {
+			pipeline = bson.A{}
+		}
+		facet = append(facet, bson.E{f.Name, pipeline})
+	}
+	return b.addStage("$facet", facet)
+}
+
+// Bucket groups documents into buckets between the given boundaries
+func (b *QueryBuilder) Bucket(request *BucketModel) *QueryBuilder {
+	if request == nil {
+		return b
+	}
+
+	bucket := bson.D{
+		{"groupBy", request.GroupBy},
+		{"boundaries", request.Boundaries},
+	}
+	if request.Default != nil {
+		bucket = append(bucket, bson.E{"default", request.Default})
+	}
+	if len(request.Output) > 0 {
+		bucket = append(bucket, bson.E{"output", accumulators(request.Output)})
+	}
+	return b.addStage("$bucket", bucket)
+}
+
+// BucketAuto groups documents into a number of evenly distributed buckets
+func (b *QueryBuilder) BucketAuto(request *BucketAutoModel) *QueryBuilder {
+	if request == nil {
+		return b
+	}
+
+	bucket := bson.D{
+		{"groupBy", request.GroupBy},
+		{"buckets", request.Buckets},
+	}
+	if len(request.Output) > 0 {
+		bucket = append(bucket, bson.E{"output", accumulators(request.Output)})
+	}
+	if request.Granularity != "" {
+		bucket = append(bucket, bson.E{"granularity", request.Granularity})
+	}
+	return b.addStage("$bucketAuto", bucket)
+}
+
+// Count outputs a single document with the number of input documents in field
+func (b *QueryBuilder) Count(field string) *QueryBuilder {
+	if len(field) == 0 {
+		return b
+	}
+	return b.addStage("$count", field)
+}
+
+// ReplaceRoot replaces each document with newRoot, e.g. Ref("profile") to promote an embedded document
+func (b *QueryBuilder) ReplaceRoot(newRoot any) *QueryBuilder {
+	return b.addStage("$replaceRoot", bson.D{{"newRoot", newRoot}})
+}
+
+// SortStage ... used in aggregation pipeline to sort by one or more keys, earlier keys take precedence
+//
+// Example usage: SortStage(Desc("total"), Asc("_id"))
+func (b *QueryBuilder) SortStage(fields ...SortField) *QueryBuilder {
+	if len(fields) == 0 {
+		return b
+	}
+
+	sort := make(bson.D, 0, len(fields))
+	for _, f := range fields {
+		sort = append(sort, bson.E{f.Key.String(), f.Order})
+	}
+	return b.addStage("$sort", sort)
+}
+
+// Sample randomly selects size documents
+func (b *QueryBuilder) Sample(size int64) *QueryBuilder {
+	return b.addStage("$sample", bson.D{{"size", size}})
+}
+
+// UnionWith adds the documents of another collection, optionally filtered by pipeline
+func (b *QueryBuilder) UnionWith(collection string, pipeline bson.A) *QueryBuilder {
+	if pipeline == nil {
+		return b.addStage("$unionWith", collection)
+	}
+	return b.addStage("$unionWith", bson.D{{"coll", collection}, {"pipeline", pipeline}})
+}
+
+// Out writes the results to collection, replacing its content. Must be the last stage.
+func (b *QueryBuilder) Out(collection string) *QueryBuilder {
+	return b.addStage("$out", collection)
+}
+
+// Merge writes the results into a collection, merging them with existing documents. Must be the last stage.
+func (b *QueryBuilder) Merge(request *MergeModel) *QueryBuilder {
+	if request == nil {
+		return b
+	}
+
+	merge := bson.D{{"into", request.Into}}
+	if len(request.On) > 0 {
+		merge = append(merge, bson.E{"on", request.On})
+	}
+	if request.WhenMatched != nil {
+		merge = append(merge, bson.E{"whenMatched", request.WhenMatched})
+	}
+	if request.WhenNotMatched != "" {
+		merge = append(merge, bson.E{"whenNotMatched", request.WhenNotMatched})
+	}
+	return b.addStage("$merge", merge)
+}
+
+func (b *QueryBuilder) addStage(name string, spec any) *QueryBuilder {
+	aggregate := b.aggregate
+	aggregate = append(aggregate, bson.D{{name, spec}})
+	b.aggregate = aggregate
+	return b
+}
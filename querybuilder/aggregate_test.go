@@ -0,0 +1,91 @@
+package querybuilder
+
+import (
+	"github.com/dinson/mongokit/geojson"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func pipelineJSON(t *testing.T, pipeline bson.A) string {
+	t.Helper()
+
+	data, err := bson.MarshalExtJSON(bson.D{{"pipeline", pipeline}}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAggregateIncludeFiltersPagesBeforeStages(t *testing.T) {
+	q, err := New().
+		EqualString("status", "active").
+		SortDesc("createdAt").
+		Skip(40).
+		Limit(20).
+		IncludeFilters().
+		Group(Ref("country"), Sum("users", 1)).
+		Aggregate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"pipeline":[` +
+		`{"$match":{"$and":[{"status":"active"}]}},` +
+		`{"$sort":{"createdAt":-1}},` +
+		`{"$skip":40},` +
+		`{"$limit":20},` +
+		`{"$group":{"_id":"$country","users":{"$sum":1}}}]}`
+	if got := pipelineJSON(t, q.Aggregate); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestAggregateIncludeFiltersKeepsGeoNearFirst(t *testing.T) {
+	q, err := New().
+		EqualString("status", "open").
+		SortAsc("name").
+		Limit(10).
+		IncludeFilters().
+		GeoNear(&GeoNearModel{
+			Near:          geojson.NewPoint(13.4, 52.5),
+			DistanceField: "distance",
+			Query:         bson.D{{"type", "store"}},
+		}).
+		Aggregate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Aggregate) != 3 || !isGeoNearStage(q.Aggregate[0]) {
+		t.Fatalf("$geoNear is not the first stage: %s", pipelineJSON(t, q.Aggregate))
+	}
+
+	spec := q.Aggregate[0].(bson.D)[0].Value.(bson.D)
+	var query any
+	for _, e := range spec {
+		if e.Key == "query" {
+			query = e.Value
+		}
+	}
+
+	got := pipelineJSON(t, bson.A{query, q.Aggregate[1], q.Aggregate[2]})
+	want := `{"pipeline":[` +
+		`{"$and":[{"type":"store"},{"$and":[{"status":"open"}]}]},` +
+		`{"$sort":{"name":1}},` +
+		`{"$limit":10}]}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestAggregateWithoutIncludeFiltersPagesAtTheEnd(t *testing.T) {
+	q, err := New().Limit(5).Match("deleted", false).Aggregate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"pipeline":[{"$match":{"deleted":false}},{"$limit":5}]}`
+	if got := pipelineJSON(t, q.Aggregate); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,76 @@
+package querybuilder
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// ElemMatch matches documents where at least one element of the array field key
+// satisfies every filter of the group. Keys inside the group are relative to the array element.
+//
+// Example usage: an order line with sku "A1" and a quantity of at least 2 in the same element
+//
+//	querybuilder.New().ElemMatch("items", func(g *querybuilder.QueryBuilder) {
+//		g.EqualString("sku", "A1").Where(querybuilder.Gte("qty", 2))
+//	})
+func (b *QueryBuilder) ElemMatch(key KeyMongoDB, group func(g *QueryBuilder)) *QueryBuilder {
+	g := b.subBuilder(group)
+	if g.error != nil {
+		b.error = g.error
+		return b
+	}
+
+	if len(g.filters) == 0 {
+		return b
+	}
+
+	// merge the group into a single document, unless a key repeats and would be overwritten
+	var match bson.D
+	seen := map[string]bool{}
+merge:
+	for _, f := range g.filters {
+		for _, e := range f {
+			if seen[e.Key] {
+				match = bson.D{{"$and", g.filters}}
+				break merge
+			}
+			seen[e.Key] = true
+			match = append(match, e)
+		}
+	}
+
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$elemMatch", match}}}})
+	b.filters = filters
+	return b
+}
+
+// Size matches documents where the array field key has exactly n elements
+func (b *QueryBuilder) Size(key KeyMongoDB, n int) *QueryBuilder {
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$size", n}}}})
+	b.filters = filters
+	return b
+}
+
+// AllOf matches documents where the array field key contains every one of the values
+func (b *QueryBuilder) AllOf(key KeyMongoDB, values []any) *QueryBuilder {
+	if len(values) == 0 {
+		return b
+	}
+
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$all", values}}}})
+	b.filters = filters
+	return b
+}
+
+// NotIn matches documents where the value of key is none of the values.
+// For array fields, it matches documents where no element is one of the values.
+func (b *QueryBuilder) NotIn(key KeyMongoDB, values []any) *QueryBuilder {
+	if len(values) == 0 {
+		return b
+	}
+
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$nin", values}}}})
+	b.filters = filters
+	return b
+}
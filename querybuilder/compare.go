@@ -0,0 +1,105 @@
+package querybuilder
+
+import (
+	"cmp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Comparable lists the types that can be compared and range filtered in a type safe way
+type Comparable interface {
+	cmp.Ordered | time.Time | primitive.DateTime | primitive.Decimal128 | primitive.ObjectID | primitive.Timestamp
+}
+
+// Condition is a single filter expression, added to a query with Where.
+//
+// Example usage:
+//
+//	querybuilder.New().Where(
+//		querybuilder.Gte("price", 9.99),
+//		querybuilder.Between("createdAt", from, to),
+//	)
+type Condition bson.D
+
+// Eq matches documents where the value of key equals value
+func Eq[V Comparable](key KeyMongoDB, value V) Condition {
+	return Condition{{key.String(), value}}
+}
+
+// Ne matches documents where the value of key does not equal value
+func Ne[V Comparable](key KeyMongoDB, value V) Condition {
+	return operator(key, "$ne", value)
+}
+
+// Gt matches documents where the value of key is greater than value
+func Gt[V Comparable](key KeyMongoDB, value V) Condition {
+	return operator(key, "$gt", value)
+}
+
+// Gte matches documents where the value of key is greater than or equal to value
+func Gte[V Comparable](key KeyMongoDB, value V) Condition {
+	return operator(key, "$gte", value)
+}
+
+// Lt matches documents where the value of key is less than value
+func Lt[V Comparable](key KeyMongoDB, value V) Condition {
+	return operator(key, "$lt", value)
+}
+
+// Lte matches documents where the value of key is less than or equal to value
+func Lte[V Comparable](key KeyMongoDB, value V) Condition {
+	return operator(key, "$lte", value)
+}
+
+// Between matches documents where the value of key is within lo and hi, both inclusive
+func Between[V Comparable](key KeyMongoDB, lo, hi V) Condition {
+	return Condition{{key.String(), bson.D{{"$gte", lo}, {"$lte", hi}}}}
+}
+
+func operator(key KeyMongoDB, op string, value any) Condition {
+	return Condition{{key.String(), bson.D{{op, value}}}}
+}
+
+// Where adds the conditions to the filters.
+// Empty conditions are ignored.
+func (b *QueryBuilder) Where(conditions ...Condition) *QueryBuilder {
+	filters := b.filters
+	for _, c := range conditions {
+		if len(c) == 0 {
+			continue
+		}
+		filters = append(filters, bson.D(c))
+	}
+	b.filters = filters
+	return b
+}
+
+// DateRange matches dates from "from" (inclusive) up to "to" (exclusive).
+// A zero from or to leaves that side of the range open, so the helper can be fed
+// optional API parameters directly. If both are zero, no filter is added.
+func (b *QueryBuilder) DateRange(key KeyMongoDB, from, to time.Time) *QueryBuilder {
+	var bounds bson.D
+	if !from.IsZero() {
+		bounds = append(bounds, bson.E{"$gte", from})
+	}
+	if !to.IsZero() {
+		bounds = append(bounds, bson.E{"$lt", to})
+	}
+
+	if len(bounds) == 0 {
+		return b
+	}
+
+	return b.Where(Condition{{key.String(), bounds}})
+}
+
+// OnDate matches dates within the calendar day of "day", in the location of "day"
+func (b *QueryBuilder) OnDate(key KeyMongoDB, day time.Time) *QueryBuilder {
+	if day.IsZero() {
+		return b
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	return b.DateRange(key, start, start.AddDate(0, 0, 1))
+}
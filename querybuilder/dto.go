@@ -1,6 +1,9 @@
 package querybuilder
 
-import "go.mongodb.org/mongo-driver/bson"
+import (
+	"github.com/dinson/mongokit/geojson"
+	"go.mongodb.org/mongo-driver/bson"
+)
 
 type LookupModel struct {
 	From         string // The foreign collection - specifies the target collection from which to retrieve the documents.
@@ -9,3 +12,66 @@ type LookupModel struct {
 	Pipeline     bson.A // additional stages for filtering the joined documents.
 	As           string // Output array field - specifies the name of the new array field that will be added to the input documents
 }
+
+type GeoNearModel struct {
+	Near               geojson.Point // The point for which to find the closest documents
+	DistanceField      string        // Output field that contains the calculated distance, in meters
+	Key                KeyMongoDB    // Geospatial indexed field to use, required only when the collection has more than one
+	MaxDistance        float64       // Maximum distance from Near in meters, 0 for no limit
+	MinDistance        float64       // Minimum distance from Near in meters, 0 for no limit
+	Query              bson.D        // Limits the results to documents that match the query
+	DistanceMultiplier float64       // Factor to multiply all distances by, e.g. 0.001 to output kilometers
+	IncludeLocs        string        // Output field that contains the location used to calculate the distance
+}
+
+type UnwindOptions struct {
+	IncludeArrayIndex          string // Output field that holds the array index of the element
+	PreserveNullAndEmptyArrays bool   // Output documents whose array is null, missing or empty
+}
+
+type FacetModel struct {
+	Name     string // Output field of the facet
+	Pipeline bson.A // Stages run on the input documents, e.g. the Aggregate of another QueryBuilder
+}
+
+type BucketModel struct {
+	GroupBy    any           // Expression to group by, e.g. Ref("price")
+	Boundaries bson.A        // Sorted lower bounds of each bucket, the last value is the exclusive upper bound
+	Default    any           // Bucket _id for documents outside the boundaries, nil to fail on such documents
+	Output     []Accumulator // Fields computed for each bucket, defaults to a count
+}
+
+type BucketAutoModel struct {
+	GroupBy     any           // Expression to group by, e.g. Ref("price")
+	Buckets     int           // Number of buckets
+	Output      []Accumulator // Fields computed for each bucket, defaults to a count
+	Granularity string        // Optional preferred number series, e.g. "R5" or "POWERSOF2"
+}
+
+type MergeModel struct {
+	Into           any      // Output collection name, or bson.D{{"db", db}, {"coll", coll}}
+	On             []string // Fields that identify a matching document, defaults to _id
+	WhenMatched    any      // "replace", "keepExisting", "merge", "fail" or an update pipeline
+	WhenNotMatched string   // "insert", "discard" or "fail"
+}
+
+// FilterRequest is the JSON filter format sent by API clients, applied with ApplyFilter.
+//
+// Example: {"filter":{"or":[{"field":"status","op":"eq","value":"active"},{"field":"age","op":"gte","value":18}]},"sort":"-createdAt","limit":20}
+type FilterRequest struct {
+	Filter *FilterNode `json:"filter,omitempty"` // Conditions the documents must match
+	Sort   string      `json:"sort,omitempty"`   // Comma separated keys, "-" prefixed for descending, as in SortFromString
+	Limit  int64       `json:"limit,omitempty"`  // Maximum number of documents, capped by AllowList.MaxLimit
+	Cursor string      `json:"cursor,omitempty"` // _id hex of the last document of the previous page, requires no sort or a sort by _id alone
+}
+
+// FilterNode is either a condition on a field, or a group of nodes. Exactly one of Field, And, Or, Nor and Not is set.
+type FilterNode struct {
+	Field KeyMongoDB    `json:"field,omitempty"` // Field of the condition
+	Op    Operator      `json:"op,omitempty"`    // Operator of the condition
+	Value any           `json:"value,omitempty"` // Value of the condition, an array for in and nin
+	And   []*FilterNode `json:"and,omitempty"`   // Matches when every node matches
+	Or    []*FilterNode `json:"or,omitempty"`    // Matches when any node matches
+	Nor   []*FilterNode `json:"nor,omitempty"`   // Matches when no node matches
+	Not   *FilterNode   `json:"not,omitempty"`   // Matches when the node does not match
+}
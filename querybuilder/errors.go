@@ -4,4 +4,16 @@ import "errors"
 
 var (
 	errInvalidPointer = errors.New("INVALID_POINTER")
+	errNotKeyMismatch = errors.New("NOT_GROUP_KEY_MISMATCH")
+	errInvalidSortKey = errors.New("INVALID_SORT_KEY")
+)
+
+var (
+	errInvalidFilter      = errors.New("INVALID_FILTER")
+	errFieldNotAllowed    = errors.New("FIELD_NOT_ALLOWED")
+	errOperatorNotAllowed = errors.New("OPERATOR_NOT_ALLOWED")
+	errInvalidFilterValue = errors.New("INVALID_FILTER_VALUE")
+	errFilterTooDeep      = errors.New("FILTER_TOO_DEEP")
+	errFilterTooLarge     = errors.New("FILTER_TOO_LARGE")
+	errInvalidCursor      = errors.New("INVALID_CURSOR")
 )
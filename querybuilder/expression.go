@@ -0,0 +1,164 @@
+package querybuilder
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Ref returns the field path expression of key, e.g. "price" -> "$price"
+func Ref(key KeyMongoDB) string {
+	return "$" + key.String()
+}
+
+// Expr builds an aggregation operator expression.
+// A single argument is passed as is, several arguments are passed as an array.
+//
+// Example usage: Expr("$multiply", Ref("price"), Ref("qty")) -> {$multiply: ["$price", "$qty"]}
+func Expr(operator string, args ...any) bson.D {
+	if len(args) == 1 {
+		return bson.D{{operator, args[0]}}
+	}
+	return bson.D{{operator, bson.A(args)}}
+}
+
+// Literal returns value without parsing it as an expression, e.g. a string starting with "$"
+func Literal(value any) bson.D {
+	return bson.D{{"$literal", value}}
+}
+
+// Add returns the sum of numbers, or adds milliseconds to a date
+func Add(args ...any) bson.D {
+	return bson.D{{"$add", bson.A(args)}}
+}
+
+// Subtract returns a minus b
+func Subtract(a, b any) bson.D {
+	return bson.D{{"$subtract", bson.A{a, b}}}
+}
+
+// Multiply returns the product of numbers
+func Multiply(args ...any) bson.D {
+	return bson.D{{"$multiply", bson.A(args)}}
+}
+
+// Divide returns a divided by b
+func Divide(a, b any) bson.D {
+	return bson.D{{"$divide", bson.A{a, b}}}
+}
+
+// Concat concatenates strings
+func Concat(args ...any) bson.D {
+	return bson.D{{"$concat", bson.A(args)}}
+}
+
+// Cond returns then if condition is true, otherwise otherwise
+func Cond(condition, then, otherwise any) bson.D {
+	return bson.D{{"$cond", bson.D{{"if", condition}, {"then", then}, {"else", otherwise}}}}
+}
+
+// IfNull returns replacement when expression is null or missing
+func IfNull(expression, replacement any) bson.D {
+	return bson.D{{"$ifNull", bson.A{expression, replacement}}}
+}
+
+// DateToString formats a date expression, e.g. DateToString("%Y-%m-%d", Ref("createdAt"))
+func DateToString(format string, date any) bson.D {
+	return bson.D{{"$dateToString", bson.D{{"format", format}, {"date", date}}}}
+}
+
+// Accumulator computes an output field of Group, Bucket and BucketAuto
+type Accumulator struct {
+	Field      string // output field name
+	Operator   string // accumulator operator, e.g. $sum
+	Expression any    // expression the operator is applied to
+}
+
+// Sum accumulates the sum of expression, use Sum(field, 1) to count documents
+func Sum(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$sum", Expression: expression}
+}
+
+// Avg accumulates the average of expression
+func Avg(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$avg", Expression: expression}
+}
+
+// Min accumulates the lowest value of expression
+func Min(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$min", Expression: expression}
+}
+
+// Max accumulates the highest value of expression
+func Max(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$max", Expression: expression}
+}
+
+// First accumulates the value of expression for the first document of each group
+func First(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$first", Expression: expression}
+}
+
+// Last accumulates the value of expression for the last document of each group
+func Last(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$last", Expression: expression}
+}
+
+// Push accumulates an array of every value of expression
+func Push(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$push", Expression: expression}
+}
+
+// AddToSet accumulates an array of the unique values of expression
+func AddToSet(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$addToSet", Expression: expression}
+}
+
+// FieldExpr is an output field of Project and AddFields
+type FieldExpr struct {
+	Field      string
+	Expression any
+}
+
+// Include keeps key in the output of Project
+func Include(key KeyMongoDB) FieldExpr {
+	return FieldExpr{Field: key.String(), Expression: 1}
+}
+
+// Exclude removes key from the output of Project
+func Exclude(key KeyMongoDB) FieldExpr {
+	return FieldExpr{Field: key.String(), Expression: 0}
+}
+
+// Computed sets field to the result of expression
+func Computed(field string, expression any) FieldExpr {
+	return FieldExpr{Field: field, Expression: expression}
+}
+
+// SortField is a key of SortStage
+type SortField struct {
+	Key   KeyMongoDB
+	Order int
+}
+
+// Asc sorts ascending by key
+func Asc(key KeyMongoDB) SortField {
+	return SortField{Key: key, Order: 1}
+}
+
+// Desc sorts descending by key
+func Desc(key KeyMongoDB) SortField {
+	return SortField{Key: key, Order: -1}
+}
+
+func accumulators(accs []Accumulator) bson.D {
+	resp := make(bson.D, 0, len(accs))
+	for _, acc := range accs {
+		resp = append(resp, bson.E{acc.Field, bson.D{{acc.Operator, acc.Expression}}})
+	}
+	return resp
+}
+
+func fieldExpressions(fields []FieldExpr) bson.D {
+	resp := make(bson.D, 0, len(fields))
+	for _, f := range fields {
+		resp = append(resp, bson.E{f.Field, f.Expression})
+	}
+	return resp
+}
@@ -0,0 +1,361 @@
+package querybuilder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dinson/mongokit/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	maxFilterDepth  = 8
+	maxFilterNodes  = 100
+	maxFilterValues = 1000
+)
+
+// Operator is a comparison of the JSON filter format
+type Operator string
+
+const (
+	OpEq         Operator = "eq"
+	OpNe         Operator = "ne"
+	OpGt         Operator = "gt"
+	OpGte        Operator = "gte"
+	OpLt         Operator = "lt"
+	OpLte        Operator = "lte"
+	OpIn         Operator = "in"
+	OpNin        Operator = "nin"
+	OpExists     Operator = "exists"
+	OpStartsWith Operator = "startsWith"
+)
+
+var (
+	// EqualityOperators compare a field with one or several values
+	EqualityOperators = []Operator{OpEq, OpNe, OpIn, OpNin}
+	// RangeOperators compare ordered fields such as numbers and dates
+	RangeOperators = []Operator{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNin}
+)
+
+var mongoOperators = map[Operator]string{
+	OpNe:  "$ne",
+	OpGt:  "$gt",
+	OpGte: "$gte",
+	OpLt:  "$lt",
+	OpLte: "$lte",
+	OpIn:  "$in",
+	OpNin: "$nin",
+}
+
+// AllowList declares the fields API clients may filter and sort on, and the operators allowed on each of them.
+// Anything else in a FilterRequest is rejected.
+type AllowList struct {
+	Fields map[KeyMongoDB][]Operator
+	// MaxLimit caps the limit of requests, and is the limit of requests without one. 0 for no cap.
+	MaxLimit int64
+}
+
+// ParseFilterRequest decodes a FilterRequest from JSON, rejecting unknown properties
+func ParseFilterRequest(data []byte) (*FilterRequest, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var req FilterRequest
+	if err := decoder.Decode(&req); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidFilter, err)
+	}
+
+	return &req, nil
+}
+
+/*
+		ApplyFilter adds the filter, sort, limit and cursor of a request sent by an API client,
+		allowing only the fields and operators of allow. Violations are returned by Build.
+
+		With a Model, values are converted to the type of their field: ObjectID hex strings,
+		RFC 3339 dates and integers are accepted for the fields of those types.
+
+	 	Example usage:
+
+		allow := querybuilder.AllowList{
+			Fields: map[querybuilder.KeyMongoDB][]querybuilder.Operator{
+				"status":    querybuilder.EqualityOperators,
+				"createdAt": querybuilder.RangeOperators,
+				"name":      {querybuilder.OpEq, querybuilder.OpStartsWith},
+			},
+			MaxLimit: 100,
+		}
+
+		req, err := querybuilder.ParseFilterRequest(body)
+		query, err := querybuilder.New().Model(User{}).ApplyFilter(req, allow).Build()
+*/
+func (b *QueryBuilder) ApplyFilter(req *FilterRequest, allow AllowList) *QueryBuilder {
+	if req == nil || b.error != nil {
+		return b
+	}
+
+	p := &filterParser{allow: allow}
+	if b.model != nil {
+		p.fields = map[string]utils.Field{}
+		for _, f := range utils.BSONFields(b.model) {
+			p.fields[f.Path] = f
+		}
+	}
+
+	if req.Filter != nil {
+		filter, err := p.node(req.Filter, 1)
+		if err != nil {
+			b.error = err
+			return b
+		}
+		filters := b.filters
+		filters = append(filters, filter)
+		b.filters = filters
+	}
+
+	for _, part := range strings.Split(req.Sort, ",") {
+		key := strings.TrimLeft(strings.TrimSpace(part), "+-")
+		if key == "" {
+			continue
+		}
+		if _, ok := allow.Fields[KeyMongoDB(key)]; !ok {
+			b.error = fmt.Errorf("%w: %s", errFieldNotAllowed, key)
+			return b
+		}
+	}
+	b.SortFromString(req.Sort)
+
+	switch {
+	case req.Limit < 0:
+		b.error = fmt.Errorf("%w: negative limit", errInvalidFilter)
+		return b
+	case allow.MaxLimit > 0 && (req.Limit == 0 || req.Limit > allow.MaxLimit):
+		b.Limit(allow.MaxLimit)
+	case req.Limit > 0:
+		b.Limit(req.Limit)
+	}
+
+	if req.Cursor != "" {
+		if _, err := primitive.ObjectIDFromHex(req.Cursor); err != nil {
+			b.error = errInvalidCursor
+			return b
+		}
+
+		// the cursor is an _id, it only pages results sorted by _id alone
+		switch {
+		case len(b.sort) == 0:
+			b.SortAsc("_id")
+			b.AfterID(req.Cursor)
+		case len(b.sort) == 1 && b.sort[0].Key == "_id" && b.sort[0].Value == -1:
+			b.BeforeID(req.Cursor)
+		case len(b.sort) == 1 && b.sort[0].Key == "_id":
+			b.AfterID(req.Cursor)
+		default:
+			b.error = fmt.Errorf("%w: results must be sorted by _id alone", errInvalidCursor)
+			return b
+		}
+	}
+
+	return b
+}
+
+type filterParser struct {
+	allow  AllowList
+	fields map[string]utils.Field // bson fields of the model, nil without a model
+	nodes  int                    // nodes parsed so far, bounded by maxFilterNodes
+}
+
+func (p *filterParser) node(n *FilterNode, depth int) (bson.D, error) {
+	if n == nil {
+		return nil, fmt.Errorf("%w: empty node", errInvalidFilter)
+	}
+	if depth > maxFilterDepth {
+		return nil, errFilterTooDeep
+	}
+	// wide groups are as costly as deep ones
+	p.nodes++
+	if p.nodes > maxFilterNodes {
+		return nil, errFilterTooLarge
+	}
+
+	set := 0
+	for _, present := range []bool{n.Field != "", n.And != nil, n.Or != nil, n.Nor != nil, n.Not != nil} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("%w: a node has exactly one of field, and, or, nor and not", errInvalidFilter)
+	}
+
+	switch {
+	case n.And != nil:
+		return p.group("$and", n.And, depth)
+	case n.Or != nil:
+		return p.group("$or", n.Or, depth)
+	case n.Nor != nil:
+		return p.group("$nor", n.Nor, depth)
+	case n.Not != nil:
+		return p.group("$nor", []*FilterNode{n.Not}, depth)
+	}
+
+	return p.condition(n)
+}
+
+func (p *filterParser) group(operator string, nodes []*FilterNode, depth int) (bson.D, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: empty group", errInvalidFilter)
+	}
+
+	groups := make(bson.A, 0, len(nodes))
+	for _, n := range nodes {
+		filter, err := p.node(n, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, filter)
+	}
+
+	return bson.D{{operator, groups}}, nil
+}
+
+func (p *filterParser) condition(n *FilterNode) (bson.D, error) {
+	key := n.Field.String()
+
+	allowed, ok := p.allow.Fields[n.Field]
+	if !ok || strings.HasPrefix(key, "$") {
+		return nil, fmt.Errorf("%w: %s", errFieldNotAllowed, key)
+	}
+	if !containsOperator(allowed, n.Op) {
+		return nil, fmt.Errorf("%w: %s %s", errOperatorNotAllowed, n.Op, key)
+	}
+
+	switch n.Op {
+	case OpExists:
+		exists, ok := n.Value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errInvalidFilterValue, key)
+		}
+		return bson.D{{key, bson.D{{"$exists", exists}}}}, nil
+	case OpStartsWith:
+		prefix, ok := n.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errInvalidFilterValue, key)
+		}
+		// quoted, so that the prefix cannot inject a regular expression
+		return bson.D{{key, bson.D{{"$regex", "^" + regexp.QuoteMeta(prefix)}}}}, nil
+	case OpIn, OpNin:
+		values, ok := n.Value.([]any)
+		if !ok || len(values) > maxFilterValues {
+			return nil, fmt.Errorf("%w: %s", errInvalidFilterValue, key)
+		}
+		converted := make(bson.A, len(values))
+		for i, v := range values {
+			value, err := p.value(key, v)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = value
+		}
+		return bson.D{{key, bson.D{{mongoOperators[n.Op], converted}}}}, nil
+	}
+
+	value, err := p.value(key, n.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.Op == OpEq {
+		return bson.D{{key, value}}, nil
+	}
+	return bson.D{{key, bson.D{{mongoOperators[n.Op], value}}}}, nil
+}
+
+// value checks that a condition value is a JSON scalar, which cannot carry operators,
+// and converts it to the type of the field of the model
+func (p *filterParser) value(key string, value any) (any, error) {
+	switch value.(type) {
+	case nil:
+		return nil, nil
+	case string, float64, bool:
+	default:
+		return nil, fmt.Errorf("%w: %s", errInvalidFilterValue, key)
+	}
+
+	field, ok := p.fields[key]
+	if !ok {
+		return value, nil
+	}
+
+	converted, ok := convertValue(value, field.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errInvalidFilterValue, key)
+	}
+	return converted, nil
+}
+
+// convertValue converts a JSON scalar to t, or to the element type of t for arrays
+func convertValue(value any, t reflect.Type) (any, bool) {
+	for t.Kind() == reflect.Pointer || ((t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8) {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(primitive.ObjectID{}):
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		id, err := primitive.ObjectIDFromHex(s)
+		return id, err == nil
+	case t == reflect.TypeOf(time.Time{}):
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		date, err := time.Parse(time.RFC3339Nano, s)
+		return date, err == nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		_, ok := value.(string)
+		return value, ok
+	case reflect.Bool:
+		_, ok := value.(bool)
+		return value, ok
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) || math.Abs(f) > 1<<53 || reflect.Zero(t).OverflowInt(int64(f)) {
+			return nil, false
+		}
+		return int64(f), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) || f < 0 || f > 1<<53 || reflect.Zero(t).OverflowUint(uint64(f)) {
+			return nil, false
+		}
+		return int64(f), true
+	case reflect.Float32, reflect.Float64:
+		_, ok := value.(float64)
+		return value, ok
+	}
+
+	// interfaces, maps and other types take the value as it is
+	return value, true
+}
+
+func containsOperator(operators []Operator, op Operator) bool {
+	for _, o := range operators {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
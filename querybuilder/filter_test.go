@@ -0,0 +1,194 @@
+package querybuilder
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+type filterModel struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	Name   string             `bson:"name"`
+	Status string             `bson:"status"`
+	Age    uint8              `bson:"age"`
+	Score  int32              `bson:"score"`
+}
+
+var testAllowList = AllowList{
+	Fields: map[KeyMongoDB][]Operator{
+		"_id":    EqualityOperators,
+		"name":   {OpEq, OpStartsWith},
+		"status": EqualityOperators,
+		"age":    RangeOperators,
+		"score":  RangeOperators,
+		"$where": {OpEq},
+	},
+	MaxLimit: 50,
+}
+
+func filterJSON(t *testing.T, value any) string {
+	t.Helper()
+
+	data, err := bson.MarshalExtJSON(bson.D{{"v", value}}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func applyFilter(t *testing.T, body string) (*Query, error) {
+	t.Helper()
+
+	req, err := ParseFilterRequest([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New().Model(filterModel{}).ApplyFilter(req, testAllowList).Build()
+}
+
+func TestApplyFilterConditions(t *testing.T) {
+	q, err := applyFilter(t, `{"filter":{"or":[{"field":"status","op":"in","value":["active","invited"]},{"not":{"field":"age","op":"lt","value":18}}]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"v":[{"$or":[{"status":{"$in":["active","invited"]}},{"$nor":[{"age":{"$lt":18}}]}]}]}`
+	if got := filterJSON(t, q.Filters); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestApplyFilterStartsWithIsQuoted(t *testing.T) {
+	q, err := applyFilter(t, `{"filter":{"field":"name","op":"startsWith","value":"a.*(b|c)"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"v":[{"name":{"$regex":"^a\\.\\*\\(b\\|c\\)"}}]}`
+	if got := filterJSON(t, q.Filters); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestApplyFilterRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+	}{
+		{"field not allowed", `{"filter":{"field":"password","op":"eq","value":"x"}}`, errFieldNotAllowed},
+		{"$ prefixed field", `{"filter":{"field":"$where","op":"eq","value":"sleep(1000)"}}`, errFieldNotAllowed},
+		{"operator not allowed", `{"filter":{"field":"status","op":"gt","value":"a"}}`, errOperatorNotAllowed},
+		{"startsWith not allowed", `{"filter":{"field":"status","op":"startsWith","value":"a"}}`, errOperatorNotAllowed},
+		{"sort field not allowed", `{"sort":"-password"}`, errFieldNotAllowed},
+		{"operator in value", `{"filter":{"field":"status","op":"eq","value":{"$ne":null}}}`, errInvalidFilterValue},
+		{"in without array", `{"filter":{"field":"status","op":"in","value":"active"}}`, errInvalidFilterValue},
+		{"negative uint", `{"filter":{"field":"age","op":"gte","value":-1}}`, errInvalidFilterValue},
+		{"uint overflow", `{"filter":{"field":"age","op":"gte","value":256}}`, errInvalidFilterValue},
+		{"int overflow", `{"filter":{"field":"score","op":"gte","value":3000000000}}`, errInvalidFilterValue},
+		{"fraction on an int field", `{"filter":{"field":"score","op":"eq","value":1.5}}`, errInvalidFilterValue},
+		{"invalid ObjectID", `{"filter":{"field":"_id","op":"eq","value":"nope"}}`, errInvalidFilterValue},
+		{"several kinds in a node", `{"filter":{"field":"status","op":"eq","value":"a","and":[]}}`, errInvalidFilter},
+		{"empty group", `{"filter":{"and":[]}}`, errInvalidFilter},
+		{"negative limit", `{"limit":-1}`, errInvalidFilter},
+		{"invalid cursor", `{"cursor":"nope"}`, errInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := applyFilter(t, tt.body); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApplyFilterBounds(t *testing.T) {
+	deep := &FilterNode{Field: "status", Op: OpEq, Value: "active"}
+	for i := 0; i < maxFilterDepth; i++ {
+		deep = &FilterNode{Not: deep}
+	}
+	if _, err := New().ApplyFilter(&FilterRequest{Filter: deep}, testAllowList).Build(); !errors.Is(err, errFilterTooDeep) {
+		t.Errorf("deep filter: got %v, want %v", err, errFilterTooDeep)
+	}
+
+	wide := &FilterNode{}
+	for i := 0; i < maxFilterNodes; i++ {
+		wide.Or = append(wide.Or, &FilterNode{Field: "status", Op: OpEq, Value: "active"})
+	}
+	if _, err := New().ApplyFilter(&FilterRequest{Filter: wide}, testAllowList).Build(); !errors.Is(err, errFilterTooLarge) {
+		t.Errorf("wide filter: got %v, want %v", err, errFilterTooLarge)
+	}
+
+	values := make([]any, maxFilterValues+1)
+	for i := range values {
+		values[i] = "active"
+	}
+	many := &FilterNode{Field: "status", Op: OpIn, Value: values}
+	if _, err := New().ApplyFilter(&FilterRequest{Filter: many}, testAllowList).Build(); !errors.Is(err, errInvalidFilterValue) {
+		t.Errorf("too many values: got %v, want %v", err, errInvalidFilterValue)
+	}
+}
+
+func TestApplyFilterLimit(t *testing.T) {
+	tests := []struct {
+		body string
+		want int64
+	}{
+		{`{}`, 50},
+		{`{"limit":10}`, 10},
+		{`{"limit":500}`, 50},
+	}
+
+	for _, tt := range tests {
+		q, err := applyFilter(t, tt.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Options.Limit == nil || *q.Options.Limit != tt.want {
+			t.Errorf("%s: got limit %v, want %d", tt.body, q.Options.Limit, tt.want)
+		}
+	}
+}
+
+func TestApplyFilterCursor(t *testing.T) {
+	cursor := "65a000000000000000000000"
+
+	tests := []struct {
+		name    string
+		sort    string
+		filter  string
+		sortDoc string
+		err     error
+	}{
+		{"no sort", "", "$gt", `{"v":{"_id":1}}`, nil},
+		{"_id ascending", "_id", "$gt", `{"v":{"_id":1}}`, nil},
+		{"_id descending", "-_id", "$lt", `{"v":{"_id":-1}}`, nil},
+		{"other field", "name", "", "", errInvalidCursor},
+		{"_id and another field", "_id,name", "", "", errInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := applyFilter(t, `{"sort":"`+tt.sort+`","cursor":"`+cursor+`"}`)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantFilter := `{"v":[{"_id":{"` + tt.filter + `":{"$oid":"` + cursor + `"}}}]}`
+			if got := filterJSON(t, q.Filters); got != wantFilter {
+				t.Errorf("got filters %s, want %s", got, wantFilter)
+			}
+			if got := filterJSON(t, q.Options.Sort); got != tt.sortDoc {
+				t.Errorf("got sort %s, want %s", got, tt.sortDoc)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package querybuilder
+
+import (
+	"github.com/dinson/mongokit/geojson"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// earthRadiusMeters is the equatorial radius used to convert distances to radians for $centerSphere
+const earthRadiusMeters = 6378100.0
+
+// Near matches documents with a location near point and sorts them from nearest to farthest.
+// Distances are in meters, a zero distance leaves that bound unset.
+// Requires a 2dsphere index on key.
+//
+// Example usage: nearest 10 within 5 km
+//
+//	querybuilder.New().Near("location", geojson.NewPoint(lng, lat), 5000, 0).Limit(10)
+func (b *QueryBuilder) Near(key KeyMongoDB, point geojson.Point, maxDistanceMeters, minDistanceMeters float64) *QueryBuilder {
+	near := bson.D{{"$geometry", point}}
+	if maxDistanceMeters > 0 {
+		near = append(near, bson.E{"$maxDistance", maxDistanceMeters})
+	}
+	if minDistanceMeters > 0 {
+		near = append(near, bson.E{"$minDistance", minDistanceMeters})
+	}
+
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$near", near}}}})
+	b.filters = filters
+	return b
+}
+
+// GeoWithinBox matches documents with a location inside the rectangle between bottomLeft and topRight
+func (b *QueryBuilder) GeoWithinBox(key KeyMongoDB, bottomLeft, topRight geojson.Point) *QueryBuilder {
+	return b.GeoWithinPolygon(key, geojson.NewBox(bottomLeft, topRight))
+}
+
+// GeoWithinPolygon matches documents with a location inside polygon
+func (b *QueryBuilder) GeoWithinPolygon(key KeyMongoDB, polygon geojson.Polygon) *QueryBuilder {
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$geoWithin", bson.D{{"$geometry", polygon}}}}}})
+	b.filters = filters
+	return b
+}
+
+// GeoWithinCenterSphere matches documents with a location within radiusMeters of center,
+// without sorting them by distance.
+func (b *QueryBuilder) GeoWithinCenterSphere(key KeyMongoDB, center geojson.Point, radiusMeters float64) *QueryBuilder {
+	centerSphere := bson.A{center.Coordinates, radiusMeters / earthRadiusMeters}
+
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$geoWithin", bson.D{{"$centerSphere", centerSphere}}}}}})
+	b.filters = filters
+	return b
+}
+
+// GeoIntersects matches documents with a geometry that intersects geometry,
+// which can be any GeoJSON geometry such as geojson.Point or geojson.Polygon.
+func (b *QueryBuilder) GeoIntersects(key KeyMongoDB, geometry any) *QueryBuilder {
+	if isNil(geometry) {
+		return b
+	}
+
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$geoIntersects", bson.D{{"$geometry", geometry}}}}}})
+	b.filters = filters
+	return b
+}
+
+// GeoNear adds a $geoNear stage, which must be the first stage of the aggregation pipeline.
+// It outputs documents sorted by distance to request.Near, with the distance in meters
+// stored in request.DistanceField.
+func (b *QueryBuilder) GeoNear(request *GeoNearModel) *QueryBuilder {
+	if request == nil {
+		return b
+	}
+
+	stage := bson.D{
+		{"near", request.Near},
+		{"distanceField", request.DistanceField},
+		{"spherical", true},
+	}
+	if request.Key != "" {
+		stage = append(stage, bson.E{"key", request.Key.String()})
+	}
+	if request.MaxDistance > 0 {
+		stage = append(stage, bson.E{"maxDistance", request.MaxDistance})
+	}
+	if request.MinDistance > 0 {
+		stage = append(stage, bson.E{"minDistance", request.MinDistance})
+	}
+	if request.Query != nil {
+		stage = append(stage, bson.E{"query", request.Query})
+	}
+	if request.DistanceMultiplier > 0 {
+		stage = append(stage, bson.E{"distanceMultiplier", request.DistanceMultiplier})
+	}
+	if request.IncludeLocs != "" {
+		stage = append(stage, bson.E{"includeLocs", request.IncludeLocs})
+	}
+
+	aggregate := b.aggregate
+	aggregate = append(aggregate, bson.D{{"$geoNear", stage}})
+	b.aggregate = aggregate
+	return b
+}
@@ -1,7 +1,37 @@
 package querybuilder
 
+import "strconv"
+
 type KeyMongoDB string
 
 func (k KeyMongoDB) String() string {
 	return string(k)
 }
+
+// Field returns the path of a field nested under k, e.g. "address" -> "address.city"
+func (k KeyMongoDB) Field(name string) KeyMongoDB {
+	return KeyMongoDB(string(k) + "." + name)
+}
+
+// Index returns the path of the array element at index i, e.g. "items" -> "items.2"
+func (k KeyMongoDB) Index(i int) KeyMongoDB {
+	return KeyMongoDB(string(k) + "." + strconv.Itoa(i))
+}
+
+// Positional returns the path of the first array element matched by the query, e.g. "items" -> "items.$".
+// Used in projections and updates.
+func (k KeyMongoDB) Positional() KeyMongoDB {
+	return KeyMongoDB(string(k) + ".$")
+}
+
+// AllPositional returns the path of every array element, e.g. "items" -> "items.$[]".
+// Used in updates.
+func (k KeyMongoDB) AllPositional() KeyMongoDB {
+	return KeyMongoDB(string(k) + ".$[]")
+}
+
+// FilteredPositional returns the path of the array elements matched by an array filter identifier,
+// e.g. "items" -> "items.$[item]". Used in updates together with array filters.
+func (k KeyMongoDB) FilteredPositional(identifier string) KeyMongoDB {
+	return KeyMongoDB(string(k) + ".$[" + identifier + "]")
+}
@@ -0,0 +1,132 @@
+package querybuilder
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+)
+
+// Or matches documents that satisfy at least one of the groups.
+// Each group is built on its own builder, and the filters within a group are ANDed together.
+// Groups without filters are ignored.
+//
+// Example usage: (status=active OR owner=me) AND deleted=false
+//
+//	querybuilder.New().
+//		Or(
+//			func(g *querybuilder.QueryBuilder) { g.EqualString("status", "active") },
+//			func(g *querybuilder.QueryBuilder) { g.EqualsIDHex("owner", me) },
+//		).
+//		EqualsBool("deleted", false)
+func (b *QueryBuilder) Or(groups ...func(g *QueryBuilder)) *QueryBuilder {
+	return b.logical("$or", groups)
+}
+
+// Nor matches documents that satisfy none of the groups.
+// Groups are built the same way as in Or.
+func (b *QueryBuilder) Nor(groups ...func(g *QueryBuilder)) *QueryBuilder {
+	return b.logical("$nor", groups)
+}
+
+// And matches documents that satisfy every group.
+// Top level filters are already ANDed, so this is mainly useful to nest an AND inside Or or Nor.
+func (b *QueryBuilder) And(groups ...func(g *QueryBuilder)) *QueryBuilder {
+	return b.logical("$and", groups)
+}
+
+// Not inverts the filters the group adds on key, using the $not operator.
+// The group may only filter on key, otherwise Build returns an error.
+//
+// Example usage: price not greater than 100, which also matches documents without a price
+//
+//	querybuilder.New().Not("price", func(g *querybuilder.QueryBuilder) { g.GreaterThan("price", 100) })
+func (b *QueryBuilder) Not(key KeyMongoDB, group func(g *QueryBuilder)) *QueryBuilder {
+	g := b.subBuilder(group)
+	if g.error != nil {
+		b.error = g.error
+		return b
+	}
+
+	var ops bson.D
+	for _, f := range g.filters {
+		for _, e := range f {
+			if e.Key != key.String() {
+				b.error = errNotKeyMismatch
+				return b
+			}
+
+			if d, ok := e.Value.(bson.D); ok && len(d) > 0 && strings.HasPrefix(d[0].Key, "$") {
+				ops = append(ops, d...)
+				continue
+			}
+			ops = append(ops, bson.E{"$eq", e.Value})
+		}
+	}
+
+	if len(ops) == 0 {
+		return b
+	}
+
+	filters := b.filters
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$not", ops}}}})
+	b.filters = filters
+	return b
+}
+
+func (b *QueryBuilder) logical(op string, groups []func(g *QueryBuilder)) *QueryBuilder {
+	var conditions bson.A
+
+	for _, group := range groups {
+		g := b.subBuilder(group)
+		if g.error != nil {
+			b.error = g.error
+			return b
+		}
+
+		if condition := g.condition(); condition != nil {
+			conditions = append(conditions, condition)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return b
+	}
+
+	filters := b.filters
+	filters = append(filters, bson.D{{op, conditions}})
+	b.filters = filters
+	return b
+}
+
+// subBuilder runs group on a new builder that shares the settings of b
+func (b *QueryBuilder) subBuilder(group func(g *QueryBuilder)) *QueryBuilder {
+	g := New()
+	g.nilMode = b.nilMode
+	if group != nil {
+		group(g)
+	}
+	return g
+}
+
+// condition returns the filters of a group as a single filter document,
+// or nil when the group has no filters
+func (b *QueryBuilder) condition() any {
+	var filters bson.A
+	if b.rawQuery != nil {
+		filters = append(filters, b.rawQuery)
+	}
+	if b.batchFilters != nil {
+		filters = append(filters, b.batchFilters)
+	}
+	for _, f := range b.filters {
+		filters = append(filters, f)
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	}
+
+	return bson.D{{"$and", filters}}
+}
@@ -0,0 +1,57 @@
+package querybuilder
+
+import "reflect"
+
+// NilMode controls how Equals, NotEquals, InArray and Match treat a nil value,
+// including typed nil pointers, maps and slices.
+type NilMode int
+
+const (
+	// EqualsNull compares nil values against null, so Equals(key, nil) matches documents
+	// where the field is null or missing. This is the default.
+	EqualsNull NilMode = iota
+
+	// OmitIfNil skips the filter entirely when the value is nil, which lets optional
+	// request parameters be passed straight to the builder.
+	OmitIfNil
+)
+
+// NilValues sets how nil values are handled by Equals, NotEquals, InArray and Match
+// for the rest of the chain.
+//
+// Example usage:
+//
+//	// status is a *string, the filter is only added when it is set
+//	querybuilder.New().NilValues(querybuilder.OmitIfNil).Equals("status", req.Status)
+func (b *QueryBuilder) NilValues(mode NilMode) *QueryBuilder {
+	b.nilMode = mode
+	return b
+}
+
+// omitNil reports whether a filter on value must be skipped
+func (b *QueryBuilder) omitNil(value any) bool {
+	return b.nilMode == OmitIfNil && isNil(value)
+}
+
+// isNil reports whether value is nil or a typed nil, without panicking on non-nillable kinds
+func isNil(value any) bool {
+	if value == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface, reflect.Chan, reflect.Func:
+		return rv.IsNil()
+	}
+
+	return false
+}
+
+// nilToNull turns typed nils into an untyped nil so that they are always encoded as null
+func nilToNull(value any) any {
+	if isNil(value) {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,39 @@
+package querybuilder
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Select returns only the given keys, plus _id unless it is excluded.
+// Cannot be combined with Exclude, except for excluding "_id".
+func (b *QueryBuilder) Select(keys ...KeyMongoDB) *QueryBuilder {
+	for _, key := range keys {
+		b.addProjection(key, 1)
+	}
+	return b
+}
+
+// Exclude returns every key except the given keys.
+// Cannot be combined with Select, except for excluding "_id".
+func (b *QueryBuilder) Exclude(keys ...KeyMongoDB) *QueryBuilder {
+	for _, key := range keys {
+		b.addProjection(key, 0)
+	}
+	return b
+}
+
+// Slice limits the number of elements returned for the array field key.
+// A positive n returns the first n elements, a negative n the last n elements.
+func (b *QueryBuilder) Slice(key KeyMongoDB, n int) *QueryBuilder {
+	return b.addProjection(key, bson.D{{"$slice", n}})
+}
+
+// addProjection sets the projection of key, replacing any previous projection of the same key
+func (b *QueryBuilder) addProjection(key KeyMongoDB, value any) *QueryBuilder {
+	for i, e := range b.projection {
+		if e.Key == key.String() {
+			b.projection[i].Value = value
+			return b
+		}
+	}
+	b.projection = append(b.projection, bson.E{key.String(), value})
+	return b
+}
@@ -20,6 +20,10 @@ type QueryBuilder struct {
 	isSetLimit            bool
 	skipCount             int64
 	sort                  bson.D
+	projection            bson.D
+	includeFilters        bool
+	model                 reflect.Type
+	nilMode               NilMode
 	error                 error
 }
 
@@ -60,14 +64,14 @@ func (b *QueryBuilder) RawQuery(q any) *QueryBuilder {
 }
 
 // Equals ... generic key value matching
-// IMPORTANT: Will PANIC if used for matching string values.
-// To filter strings, use `EqualString()` instead.
+// Accepts any BSON encodable value. How nil values are handled depends on the NilMode,
+// see NilValues.
 func (b *QueryBuilder) Equals(key KeyMongoDB, value any) *QueryBuilder {
-	if reflect.ValueOf(value).IsNil() {
+	if b.omitNil(value) {
 		return b
 	}
 	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
+	filters = append(filters, bson.D{{key.String(), nilToNull(value)}})
 	b.filters = filters
 	return b
 }
@@ -114,82 +118,85 @@ func (b *QueryBuilder) EqualNumber(key KeyMongoDB, value float64) *QueryBuilder
 	return b
 }
 
+// EqualInt matches an int value.
+//
+// Deprecated: use Where(Eq(key, value)).
 func (b *QueryBuilder) EqualInt(key KeyMongoDB, value int) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualInt8 matches an int8 value.
+//
+// Deprecated: use Where(Eq[int8](key, value)).
 func (b *QueryBuilder) EqualInt8(key KeyMongoDB, value int8) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualInt16 matches an int16 value.
+//
+// Deprecated: use Where(Eq[int16](key, value)).
 func (b *QueryBuilder) EqualInt16(key KeyMongoDB, value int16) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualInt32 matches an int32 value.
+//
+// Deprecated: use Where(Eq[int32](key, value)).
 func (b *QueryBuilder) EqualInt32(key KeyMongoDB, value int32) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualInt64 matches an int64 value.
+//
+// Deprecated: use Where(Eq[int64](key, value)).
 func (b *QueryBuilder) EqualInt64(key KeyMongoDB, value int64) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualUint matches a uint value.
+//
+// Deprecated: use Where(Eq[uint](key, value)).
 func (b *QueryBuilder) EqualUint(key KeyMongoDB, value uint) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualUint8 matches a uint8 value.
+//
+// Deprecated: use Where(Eq[uint8](key, value)).
 func (b *QueryBuilder) EqualUint8(key KeyMongoDB, value uint8) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualUint16 matches a uint16 value.
+//
+// Deprecated: use Where(Eq[uint16](key, value)).
 func (b *QueryBuilder) EqualUint16(key KeyMongoDB, value uint16) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualUint32 matches a uint32 value.
+//
+// Deprecated: use Where(Eq[uint32](key, value)).
 func (b *QueryBuilder) EqualUint32(key KeyMongoDB, value uint32) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// EqualUint64 matches a uint64 value.
+//
+// Deprecated: use Where(Eq[uint64](key, value)).
 func (b *QueryBuilder) EqualUint64(key KeyMongoDB, value uint64) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), value}})
-	b.filters = filters
-	return b
+	return b.Where(Eq(key, value))
 }
 
+// NotEquals ... generic key value exclusion
+// Accepts any BSON encodable value. How nil values are handled depends on the NilMode,
+// see NilValues.
 func (b *QueryBuilder) NotEquals(key KeyMongoDB, value any) *QueryBuilder {
-	if reflect.ValueOf(value).IsNil() {
+	if b.omitNil(value) {
 		return b
 	}
 	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), bson.D{{"$ne", value}}}})
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$ne", nilToNull(value)}}}})
 	b.filters = filters
 	return b
 }
@@ -216,41 +223,38 @@ func (b *QueryBuilder) IsNull(key KeyMongoDB) *QueryBuilder {
 	return b
 }
 
+// GreaterThanOrEqualTo compares against an int64 value.
+// To compare dates, floats, decimals or strings use Where(Gte(key, value)).
 func (b *QueryBuilder) GreaterThanOrEqualTo(key KeyMongoDB, value int64) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), bson.D{{"$gte", value}}}})
-	b.filters = filters
-	return b
+	return b.Where(Gte(key, value))
 }
 
+// LessThanOrEqualTo compares against an int64 value.
+// To compare dates, floats, decimals or strings use Where(Lte(key, value)).
 func (b *QueryBuilder) LessThanOrEqualTo(key KeyMongoDB, value int64) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), bson.D{{"$lte", value}}}})
-	b.filters = filters
-	return b
+	return b.Where(Lte(key, value))
 }
 
+// GreaterThan compares against an int64 value.
+// To compare dates, floats, decimals or strings use Where(Gt(key, value)).
 func (b *QueryBuilder) GreaterThan(key KeyMongoDB, value int64) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), bson.D{{"$gt", value}}}})
-	b.filters = filters
-	return b
+	return b.Where(Gt(key, value))
 }
 
+// LessThan compares against an int64 value.
+// To compare dates, floats, decimals or strings use Where(Lt(key, value)).
 func (b *QueryBuilder) LessThan(key KeyMongoDB, value int64) *QueryBuilder {
-	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), bson.D{{"$lt", value}}}})
-	b.filters = filters
-	return b
+	return b.Where(Lt(key, value))
 }
 
 // InArray ... check if a value exist in an array field
+// How nil values are handled depends on the NilMode, see NilValues.
 func (b *QueryBuilder) InArray(key KeyMongoDB, value any) *QueryBuilder {
-	if reflect.ValueOf(value).IsNil() {
+	if b.omitNil(value) {
 		return b
 	}
 	filters := b.filters
-	filters = append(filters, bson.D{{key.String(), bson.D{{"$all", bson.A{value}}}}})
+	filters = append(filters, bson.D{{key.String(), bson.D{{"$all", bson.A{nilToNull(value)}}}}})
 	b.filters = filters
 	return b
 }
@@ -320,34 +324,73 @@ func (b *QueryBuilder) SetFullTextSearch(keyword string) *QueryBuilder {
 // SortBySearchScore
 // sorts the results by textScore in full text search field
 // Note: use only when performing full text search
+// Keys sorted before take precedence over the score, keys sorted after break ties.
 func (b *QueryBuilder) SortBySearchScore() *QueryBuilder {
 	if len(b.fullTextSearchKeyword) == 0 {
 		return b
 	}
-	sort := bson.D{{"score", bson.D{{"$meta", "textScore"}}}}
-	b.sort = sort
-	return b
+	return b.addSort("score", bson.D{{"$meta", "textScore"}})
 }
 
 // SortAsc ... sort ascending by field "key"
-// Only allows any 1 sort
-// Multiple sort chains will be ignored
+// Sorts can be chained, earlier keys take precedence:
+// SortAsc("lastName").SortAsc("firstName").SortDesc("_id")
+// Sorting again by the same key changes its direction but keeps its position.
 func (b *QueryBuilder) SortAsc(key KeyMongoDB) *QueryBuilder {
-	if b.sort != nil {
-		return b // if sort is already set, skip this step
-	}
-	b.sort = bson.D{{key.String(), 1}}
-	return b
+	return b.addSort(key, 1)
 }
 
 // SortDesc ... sort descending by field "key"
-// Only allows any 1 sort
-// Multiple sort chains will be ignored
+// Sorts can be chained, see SortAsc.
 func (b *QueryBuilder) SortDesc(key KeyMongoDB) *QueryBuilder {
-	if b.sort != nil {
-		return b
+	return b.addSort(key, -1)
+}
+
+// ClearSort removes every sort key set so far
+func (b *QueryBuilder) ClearSort() *QueryBuilder {
+	b.sort = nil
+	return b
+}
+
+// SortFromString sorts by a comma separated list of keys, as commonly passed in API query parameters.
+// Keys prefixed with "-" are sorted descending, keys without prefix or prefixed with "+" ascending.
+//
+// Example usage: SortFromString("-createdAt,name") sorts by createdAt descending, then name ascending
+func (b *QueryBuilder) SortFromString(sort string) *QueryBuilder {
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		order := 1
+		switch part[0] {
+		case '-':
+			order = -1
+			part = part[1:]
+		case '+':
+			part = part[1:]
+		}
+
+		if part == "" || strings.HasPrefix(part, "$") {
+			b.error = errInvalidSortKey
+			return b
+		}
+
+		b.addSort(KeyMongoDB(part), order)
+	}
+	return b
+}
+
+// addSort appends key to the sort, or replaces its order if key is already sorted
+func (b *QueryBuilder) addSort(key KeyMongoDB, order any) *QueryBuilder {
+	for i, e := range b.sort {
+		if e.Key == key.String() {
+			b.sort[i].Value = order
+			return b
+		}
 	}
-	b.sort = bson.D{{key.String(), -1}}
+	b.sort = append(b.sort, bson.E{key.String(), order})
 	return b
 }
 
@@ -417,8 +460,12 @@ func (b *QueryBuilder) Build() (*Query, error) {
 
 	opts.SetSkip(b.skipCount)
 
+	projection := b.projection
 	if len(b.fullTextSearchKeyword) > 0 {
-		opts.SetProjection(bson.D{{"score", bson.D{{"$meta", "textScore"}}}})
+		projection = append(projection[:len(projection):len(projection)], bson.E{"score", bson.D{{"$meta", "textScore"}}})
+	}
+	if projection != nil {
+		opts.SetProjection(projection)
 	}
 
 	if b.sort != nil {
@@ -438,35 +485,137 @@ func (b *QueryBuilder) Build() (*Query, error) {
 		q.Filters = []bson.D{}
 	}
 
+	if b.error == nil && b.model != nil {
+		if err := Validate(q, b.model); err != nil {
+			return q, err
+		}
+	}
+
 	return q, b.error
 }
 
 // Aggregate returns the aggregate query after all the chains are complete
+//
+// With IncludeFilters, the pipeline starts with a $match of the filters and a $sort of the sort keys,
+// followed by Skip and Limit, so that the stages run on the same documents a Find would return.
+// A leading $geoNear stage stays first, the filters are added to its query.
+// Otherwise Skip and Limit are applied at the end of the pipeline, before a final $out or $merge stage.
 func (b *QueryBuilder) Aggregate() (*Query, error) {
 	q := &Query{
-		Aggregate: b.aggregate,
+		Aggregate: bson.A{},
 	}
 
-	if q.Aggregate == nil {
-		q.Aggregate = bson.A{}
+	stages := b.aggregate
+	var output bson.A
+	if n := len(stages); n > 0 && isOutputStage(stages[n-1]) {
+		stages, output = stages[:n-1], stages[n-1:]
 	}
 
-	if q.Aggregate != nil && b.isSetLimit {
-		q.Aggregate = append(q.Aggregate, bson.M{"$skip": b.skipCount})
-		q.Aggregate = append(q.Aggregate, bson.M{"$limit": b.resultCount})
+	var paging bson.A
+	if b.skipCount > 0 {
+		paging = append(paging, bson.D{{"$skip", b.skipCount}})
+	}
+	if b.isSetLimit && b.resultCount > 0 {
+		paging = append(paging, bson.D{{"$limit", b.resultCount}})
+	}
+
+	if b.includeFilters {
+		filter := (&Query{
+			Filters:      b.filters,
+			RawQuery:     b.rawQuery,
+			BatchFilters: b.batchFilters,
+		}).GetFilter()
+		d, ok := filter.(bson.D)
+		empty := ok && len(d) == 0
+
+		if len(stages) > 0 && isGeoNearStage(stages[0]) {
+			geoNear := stages[0]
+			if !empty {
+				geoNear = withGeoNearQuery(geoNear.(bson.D), filter)
+			}
+			q.Aggregate = append(q.Aggregate, geoNear)
+			stages = stages[1:]
+		} else if !empty {
+			q.Aggregate = append(q.Aggregate, bson.D{{"$match", filter}})
+		}
+
+		if len(b.sort) > 0 {
+			q.Aggregate = append(q.Aggregate, bson.D{{"$sort", b.sort}})
+		}
+
+		q.Aggregate = append(q.Aggregate, paging...)
+		paging = nil
+	}
+
+	q.Aggregate = append(q.Aggregate, stages...)
+	q.Aggregate = append(q.Aggregate, paging...)
+	q.Aggregate = append(q.Aggregate, output...)
+
+	if b.error == nil && b.model != nil {
+		if err := Validate(q, b.model); err != nil {
+			return q, err
+		}
 	}
 
 	return q, b.error
 }
 
+// IncludeFilters makes Aggregate start the pipeline with a $match of the filters, a $sort of the sort keys,
+// and the Skip and Limit set on the builder, so the same builder serves both Find and Aggregate.
+//
+// Example usage:
+//
+//	b := querybuilder.New().EqualString("status", "active").SortDesc("createdAt").Limit(20)
+//	findQuery, _ := b.Build()
+//	// countries of the 20 latest active users
+//	reportQuery, _ := b.IncludeFilters().Group(querybuilder.Ref("country"), querybuilder.Sum("users", 1)).Aggregate()
+func (b *QueryBuilder) IncludeFilters() *QueryBuilder {
+	b.includeFilters = true
+	return b
+}
+
+func isGeoNearStage(stage any) bool {
+	d, ok := stage.(bson.D)
+	return ok && len(d) == 1 && d[0].Key == "$geoNear"
+}
+
+// withGeoNearQuery returns a copy of a $geoNear stage whose query also matches filter
+func withGeoNearQuery(stage bson.D, filter any) bson.D {
+	spec, ok := stage[0].Value.(bson.D)
+	if !ok {
+		return stage
+	}
+
+	resp := make(bson.D, 0, len(spec)+1)
+	found := false
+	for _, e := range spec {
+		if e.Key == "query" {
+			e.Value = bson.D{{"$and", bson.A{e.Value, filter}}}
+			found = true
+		}
+		resp = append(resp, e)
+	}
+	if !found {
+		resp = append(resp, bson.E{"query", filter})
+	}
+
+	return bson.D{{"$geoNear", resp}}
+}
+
+func isOutputStage(stage any) bool {
+	d, ok := stage.(bson.D)
+	return ok && len(d) == 1 && (d[0].Key == "$out" || d[0].Key == "$merge")
+}
+
 // Match filters the documents in the aggregation pipeline based on specified criteria
 // Note: It is often used early in the aggregation pipeline to reduce the number of documents processed in subsequent stages.
+// How nil values are handled depends on the NilMode, see NilValues.
 func (b *QueryBuilder) Match(key KeyMongoDB, value any) *QueryBuilder {
-	if reflect.ValueOf(value).IsNil() {
+	if b.omitNil(value) {
 		return b
 	}
 	aggregate := b.aggregate
-	aggregate = append(aggregate, bson.D{{"$match", bson.D{{key.String(), value}}}})
+	aggregate = append(aggregate, bson.D{{"$match", bson.D{{key.String(), nilToNull(value)}}}})
 	b.aggregate = aggregate
 	return b
 }
@@ -517,7 +666,7 @@ func (b *QueryBuilder) NotEqualStage(key KeyMongoDB, value any) *QueryBuilder {
 		return b
 	}
 
-	if reflect.ValueOf(value).IsNil() {
+	if isNil(value) {
 		return b
 	}
 	aggregate := b.aggregate
@@ -0,0 +1,369 @@
+package querybuilder
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// what the redactor keeps as it is, every other value is replaced by a placeholder
+type redactMode int
+
+const (
+	keepFlags     redactMode = 1 << iota // 0, 1, -1 and booleans at the top level of a document: sort orders and projection flags
+	keepFieldRefs                        // "$field" references of pipeline expressions
+	keepNames                            // strings of the name fields of $lookup, $merge and the like, see nameFields
+)
+
+// nameFields are the fields of stages rendered with keepNames that hold collection or field names rather than values
+var nameFields = map[string]bool{
+	"from":         true,
+	"localField":   true,
+	"foreignField": true,
+	"as":           true,
+	"into":         true,
+	"coll":         true,
+	"path":         true,
+}
+
+// redactor renders queries as canonical JSON with their values replaced by placeholders
+type redactor struct {
+	key []byte // when set, placeholders carry a keyed hash of the value
+}
+
+// String renders the query like Redacted, so that printing or logging a query never prints its values
+func (q *Query) String() string {
+	return q.Redacted()
+}
+
+/*
+		Redacted renders the filter, sort, projection and pipeline of the query as canonical JSON,
+		with every value replaced by a placeholder of its type. Field names and operators are kept,
+		so that the shape of a query can be logged, grouped or used as a metric label safely.
+
+		Keys of maps are sorted, the order of bson.D documents is kept. Arrays of values collapse
+		to their distinct placeholders, so that $in filters of any length render the same.
+
+	 	Example usage:
+
+		query, _ := querybuilder.New().EqualString("email", email).SortDesc("createdAt").Build()
+
+		query.Redacted() // {"filter":{"$and":[{"email":"?string"}]},"sort":{"createdAt":-1}}
+*/
+func (q *Query) Redacted() string {
+	return redactor{}.query(q)
+}
+
+// RedactedHashed renders the query like Redacted, with placeholders carrying a keyed hash of each value,
+// e.g. "?string#5f1c9a3e7b20d4c8", so that queries on the same values can be correlated without revealing them.
+func (q *Query) RedactedHashed(key []byte) string {
+	return redactor{key: key}.query(q)
+}
+
+func (r redactor) query(q *Query) string {
+	if q == nil {
+		return "null"
+	}
+
+	var b strings.Builder
+
+	b.WriteString(`{"filter":`)
+	r.write(&b, q.GetFilter(), 0)
+
+	if q.Options != nil {
+		if q.Options.Sort != nil {
+			b.WriteString(`,"sort":`)
+			r.write(&b, q.Options.Sort, keepFlags)
+		}
+		if q.Options.Projection != nil {
+			b.WriteString(`,"projection":`)
+			r.write(&b, q.Options.Projection, keepFlags)
+		}
+	}
+
+	if len(q.Aggregate) > 0 {
+		b.WriteString(`,"pipeline":`)
+		r.pipeline(&b, q.Aggregate)
+	}
+
+	b.WriteString("}")
+	return b.String()
+}
+
+func (r redactor) pipeline(b *strings.Builder, stages any) {
+	values, ok := elementsOf(stages)
+	if !ok {
+		r.write(b, stages, 0)
+		return
+	}
+
+	b.WriteString("[")
+	for i, stage := range values {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		r.write(b, stage, keepFieldRefs)
+	}
+	b.WriteString("]")
+}
+
+func (r redactor) write(b *strings.Builder, value any, mode redactMode) {
+	if fields, ok := fieldsOf(value); ok {
+		r.document(b, fields, mode)
+		return
+	}
+	if values, ok := elementsOf(value); ok {
+		r.array(b, values, mode)
+		return
+	}
+	r.leaf(b, value, mode)
+}
+
+func (r redactor) document(b *strings.Builder, fields bson.D, mode redactMode) {
+	b.WriteString("{")
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		writeJSON(b, f.Key)
+		b.WriteString(":")
+
+		if mode&keepFlags != 0 && isFlag(f.Value) {
+			writeJSON(b, f.Value)
+			continue
+		}
+
+		nested := mode &^ keepFlags
+		if mode&keepNames != 0 {
+			if nameFields[f.Key] {
+				r.write(b, f.Value, mode)
+				continue
+			}
+			// other fields of the stage, e.g. the let variables of $lookup, hold values
+			nested &^= keepNames
+		}
+
+		switch f.Key {
+		case "$match", "$elemMatch", "query":
+			r.write(b, f.Value, 0)
+		case "pipeline":
+			r.pipeline(b, f.Value)
+		case "$facet":
+			r.facet(b, f.Value)
+		case "$sort", "$project":
+			r.write(b, f.Value, keepFlags|keepFieldRefs)
+		case "$lookup", "$unwind", "$unionWith", "$out", "$merge", "$count":
+			// string forms such as {"$out": "archive"} and {"$count": "total"} are names too
+			r.write(b, f.Value, keepNames|keepFieldRefs)
+		default:
+			// flags are only kept at the top level, nested expressions may hold any value
+			r.write(b, f.Value, nested)
+		}
+	}
+	b.WriteString("}")
+}
+
+// facet renders the sub pipelines of a $facet stage
+func (r redactor) facet(b *strings.Builder, value any) {
+	fields, ok := fieldsOf(value)
+	if !ok {
+		r.write(b, value, 0)
+		return
+	}
+
+	b.WriteString("{")
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		writeJSON(b, f.Key)
+		b.WriteString(":")
+		r.pipeline(b, f.Value)
+	}
+	b.WriteString("}")
+}
+
+func (r redactor) array(b *strings.Builder, values []any, mode redactMode) {
+	seen := map[string]bool{}
+
+	b.WriteString("[")
+	first := true
+	for _, v := range values {
+		var item strings.Builder
+		r.write(&item, v, mode)
+
+		_, isDoc := fieldsOf(v)
+		_, isArray := elementsOf(v)
+		if r.key == nil && !isDoc && !isArray {
+			// collapse values, so that the rendering does not depend on the number of values
+			if seen[item.String()] {
+				continue
+			}
+			seen[item.String()] = true
+		}
+
+		if !first {
+			b.WriteString(",")
+		}
+		first = false
+		b.WriteString(item.String())
+	}
+	b.WriteString("]")
+}
+
+func (r redactor) leaf(b *strings.Builder, value any, mode redactMode) {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("null")
+		return
+	case string:
+		if mode&keepNames != 0 || (mode&keepFieldRefs != 0 && strings.HasPrefix(v, "$")) {
+			writeJSON(b, v)
+			return
+		}
+	}
+
+	t, data, err := bson.MarshalValue(value)
+	if err != nil {
+		writeJSON(b, "?value")
+		return
+	}
+
+	switch t {
+	case bson.TypeNull:
+		b.WriteString("null")
+	case bson.TypeEmbeddedDocument:
+		// structs such as GeoJSON values render as documents
+		var doc bson.D
+		if err = bson.Unmarshal(data, &doc); err != nil {
+			writeJSON(b, "?document")
+			return
+		}
+		r.document(b, doc, mode)
+	case bson.TypeArray:
+		var values bson.A
+		if err = (bson.RawValue{Type: t, Value: data}).Unmarshal(&values); err != nil {
+			writeJSON(b, "?array")
+			return
+		}
+		r.array(b, values, mode)
+	default:
+		writeJSON(b, r.placeholder(t, data))
+	}
+}
+
+func (r redactor) placeholder(t bsontype.Type, data []byte) string {
+	placeholder := "?" + typeName(t)
+	if r.key == nil {
+		return placeholder
+	}
+
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte{byte(t)})
+	mac.Write(data)
+	return placeholder + "#" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func typeName(t bsontype.Type) string {
+	switch t {
+	case bson.TypeString, bson.TypeSymbol:
+		return "string"
+	case bson.TypeInt32, bson.TypeInt64:
+		return "int"
+	case bson.TypeDouble:
+		return "double"
+	case bson.TypeDecimal128:
+		return "decimal"
+	case bson.TypeBoolean:
+		return "bool"
+	case bson.TypeObjectID:
+		return "objectId"
+	case bson.TypeDateTime, bson.TypeTimestamp:
+		return "date"
+	case bson.TypeRegex:
+		return "regex"
+	case bson.TypeBinary:
+		return "binary"
+	}
+	return "value"
+}
+
+// isFlag reports whether value is a sort order or projection flag: 0, 1, -1 or a boolean
+func isFlag(value any) bool {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() >= -1 && rv.Int() <= 1
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() <= 1
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0 || rv.Float() == 1 || rv.Float() == -1
+	}
+	return false
+}
+
+// fieldsOf returns the fields of a document value in canonical order: as they are for bson.D, sorted for maps
+func fieldsOf(value any) (bson.D, bool) {
+	switch v := value.(type) {
+	case bson.D:
+		return v, true
+	case Condition:
+		return bson.D(v), true
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+
+	keys := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+
+	fields := make(bson.D, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, bson.E{Key: k, Value: rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface()})
+	}
+	return fields, true
+}
+
+// elementsOf returns the elements of an array value
+func elementsOf(value any) ([]any, bool) {
+	switch v := value.(type) {
+	case bson.A:
+		return v, true
+	case []any:
+		return v, true
+	}
+
+	// byte arrays such as ObjectIDs are values
+	rv := reflect.ValueOf(value)
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	values := make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, true
+}
+
+func writeJSON(b *strings.Builder, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.WriteString(`"?value"`)
+		return
+	}
+	b.Write(data)
+}
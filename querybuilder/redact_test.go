@@ -0,0 +1,82 @@
+package querybuilder
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestRedactedFilterAndSort(t *testing.T) {
+	q, err := New().EqualString("email", "dan@example.com").NotIn("status", []any{"a", "b", "c"}).SortDesc("createdAt").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"filter":{"$and":[{"email":"?string"},{"status":{"$nin":["?string"]}}]},"sort":{"createdAt":-1}}`
+	if got := q.Redacted(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestRedactedNameStages(t *testing.T) {
+	q := &Query{Aggregate: bson.A{
+		bson.D{{"$lookup", bson.D{
+			{"from", "users"},
+			{"localField", "authorId"},
+			{"foreignField", "_id"},
+			{"as", "author"},
+			{"let", bson.D{{"status", "$status"}, {"secret", "s3cr3t"}}},
+			{"pipeline", bson.A{bson.D{{"$match", bson.D{{"role", "admin"}}}}}},
+		}}},
+		bson.D{{"$unwind", "$author"}},
+		bson.D{{"$unwind", bson.D{{"path", "$tags"}, {"includeArrayIndex", "tagIndex"}}}},
+		bson.D{{"$unionWith", "archive"}},
+		bson.D{{"$unionWith", bson.D{{"coll", "archive"}, {"pipeline", bson.A{bson.D{{"$match", bson.D{{"email", "dan@example.com"}}}}}}}}},
+		bson.D{{"$sortByCount", "$country"}},
+		bson.D{{"$count", "total"}},
+		bson.D{{"$merge", bson.D{{"into", bson.D{{"db", "reports"}, {"coll", "daily"}}}, {"on", "day"}, {"whenMatched", "replace"}}}},
+		bson.D{{"$out", "results"}},
+	}}
+
+	want := `{"filter":{},"pipeline":[` +
+		`{"$lookup":{"from":"users","localField":"authorId","foreignField":"_id","as":"author","let":{"status":"$status","secret":"?string"},"pipeline":[{"$match":{"role":"?string"}}]}},` +
+		`{"$unwind":"$author"},` +
+		`{"$unwind":{"path":"$tags","includeArrayIndex":"?string"}},` +
+		`{"$unionWith":"archive"},` +
+		`{"$unionWith":{"coll":"archive","pipeline":[{"$match":{"email":"?string"}}]}},` +
+		`{"$sortByCount":"$country"},` +
+		`{"$count":"total"},` +
+		`{"$merge":{"into":{"db":"?string","coll":"daily"},"on":"?string","whenMatched":"?string"}},` +
+		`{"$out":"results"}]}`
+	if got := q.Redacted(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestRedactedNameFieldsOnlyInNameStages(t *testing.T) {
+	q := &Query{
+		RawQuery:  bson.D{{"from", "dan@example.com"}, {"as", "x"}},
+		Aggregate: bson.A{bson.D{{"$addFields", bson.D{{"from", "literal"}, {"path", "$tags"}}}}},
+	}
+
+	want := `{"filter":{"from":"?string","as":"?string"},"pipeline":[{"$addFields":{"from":"?string","path":"$tags"}}]}`
+	if got := q.Redacted(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestRedactedHashed(t *testing.T) {
+	a, _ := New().EqualString("email", "dan@example.com").Build()
+	b, _ := New().EqualString("email", "dan@example.com").Build()
+	c, _ := New().EqualString("email", "ann@example.com").Build()
+
+	key := []byte("key")
+	if a.RedactedHashed(key) != b.RedactedHashed(key) {
+		t.Error("equal values render differently")
+	}
+	if a.RedactedHashed(key) == c.RedactedHashed(key) {
+		t.Error("different values render the same")
+	}
+	if a.Redacted() != c.Redacted() {
+		t.Error("unhashed renderings depend on the values")
+	}
+}
@@ -0,0 +1,405 @@
+package querybuilder
+
+import (
+	"fmt"
+	"github.com/dinson/mongokit/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError lists the unknown fields and type mismatches found
+// when checking a query against the bson fields of a model.
+type ValidationError struct {
+	Model          string
+	UnknownFields  []string
+	TypeMismatches []string
+}
+
+func (e *ValidationError) Error() string {
+	var parts []string
+	if len(e.UnknownFields) > 0 {
+		parts = append(parts, fmt.Sprintf("unknown fields: %s", strings.Join(e.UnknownFields, ", ")))
+	}
+	if len(e.TypeMismatches) > 0 {
+		parts = append(parts, fmt.Sprintf("type mismatches: %s", strings.Join(e.TypeMismatches, ", ")))
+	}
+	return fmt.Sprintf("INVALID_QUERY for %s: %s", e.Model, strings.Join(parts, "; "))
+}
+
+// Model sets the model the query is checked against when Build is called.
+// Every filter, sort and projection key must then exist on the model,
+// and compared values must be compatible with the field types.
+//
+// model can be a value, a pointer or a reflect.Type of the model struct.
+func (b *QueryBuilder) Model(model any) *QueryBuilder {
+	if t := modelType(model); t != nil {
+		b.model = t
+	}
+	return b
+}
+
+// Validate checks the filters, sort, projection and leading $match stages of the query
+// against the bson fields of model and returns a *ValidationError listing every problem found.
+//
+// model can be a value, a pointer or a reflect.Type of the model struct.
+func Validate(q *Query, model any) error {
+	t := modelType(model)
+	if q == nil || t == nil {
+		return nil
+	}
+
+	v := &validator{
+		fields:     map[string]utils.Field{},
+		unknown:    map[string]struct{}{},
+		mismatches: map[string]struct{}{},
+	}
+	for _, f := range utils.BSONFields(t) {
+		v.fields[f.Path] = f
+	}
+
+	if q.RawQuery != nil {
+		v.filter(q.RawQuery, "")
+	} else if q.BatchFilters != nil {
+		v.filter(q.BatchFilters, "")
+	} else {
+		for _, f := range q.Filters {
+			v.filter(f, "")
+		}
+	}
+
+	if q.Options != nil {
+		v.keys(q.Options.Sort)
+		v.keys(q.Options.Projection)
+	}
+
+	v.pipeline(q.Aggregate)
+
+	if len(v.unknown) == 0 && len(v.mismatches) == 0 {
+		return nil
+	}
+
+	return &ValidationError{
+		Model:          t.Name(),
+		UnknownFields:  sortedKeys(v.unknown),
+		TypeMismatches: sortedKeys(v.mismatches),
+	}
+}
+
+type validator struct {
+	fields     map[string]utils.Field
+	unknown    map[string]struct{}
+	mismatches map[string]struct{}
+}
+
+// filter walks a filter document, descending into $and, $or and $nor
+func (v *validator) filter(doc any, prefix string) {
+	for _, e := range elements(doc) {
+		if strings.HasPrefix(e.Key, "$") {
+			switch e.Key {
+			case "$and", "$or", "$nor":
+				for _, item := range items(e.Value) {
+					v.filter(item, prefix)
+				}
+			}
+			// $text, $expr, $where and other top level operators are not field based
+			continue
+		}
+
+		path := prefix + e.Key
+		field, ok := v.lookup(path)
+		if !ok {
+			v.unknown[path] = struct{}{}
+			continue
+		}
+
+		v.value(path, field, e.Value)
+	}
+}
+
+// value checks a value compared against a field, either directly or through query operators
+func (v *validator) value(path string, field utils.Field, value any) {
+	ops := elements(value)
+	if len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+		v.compare(path, field, value)
+		return
+	}
+
+	for _, op := range ops {
+		switch op.Key {
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+			v.compare(path, field, op.Value)
+		case "$in", "$nin", "$all":
+			for _, item := range items(op.Value) {
+				v.compare(path, field, item)
+			}
+		case "$not":
+			v.value(path, field, op.Value)
+		case "$elemMatch":
+			sub := elements(op.Value)
+			if len(sub) > 0 && strings.HasPrefix(sub[0].Key, "$") {
+				v.value(path, field, op.Value)
+			} else {
+				v.filter(op.Value, path+".")
+			}
+		}
+		// $exists, $type, $size, $regex and geo operators do not compare against the field type
+	}
+}
+
+func (v *validator) compare(path string, field utils.Field, value any) {
+	if value == nil || field.Dynamic {
+		return
+	}
+
+	fieldType := field.Type
+	if kindOf(fieldType) == kindArray {
+		// an array field matches both a whole array and any of its elements
+		if valueType := reflect.TypeOf(value); kindOf(valueType) == kindArray {
+			elem := utils.Field{Type: elemType(fieldType)}
+			if valueElem := elemType(valueType); valueElem.Kind() != reflect.Interface {
+				v.compareTypes(path, elem.Type, valueElem)
+				return
+			}
+			for _, item := range items(value) {
+				v.compare(path, elem, item)
+			}
+			return
+		}
+		fieldType = elemType(fieldType)
+	}
+
+	v.compareTypes(path, fieldType, reflect.TypeOf(value))
+}
+
+// compareTypes records a mismatch when values of valueType cannot match a field of fieldType
+func (v *validator) compareTypes(path string, fieldType, valueType reflect.Type) {
+	fieldKind, valueKind := kindOf(fieldType), kindOf(valueType)
+	if fieldKind == kindAny || valueKind == kindAny || fieldKind == valueKind {
+		return
+	}
+	if fieldKind == kindString && valueKind == kindRegex {
+		return
+	}
+
+	v.mismatches[fmt.Sprintf("%s (%s compared to %s)", path, valueKind, fieldKind)] = struct{}{}
+}
+
+// keys checks the keys of a sort or projection document
+func (v *validator) keys(doc any) {
+	for _, e := range elements(doc) {
+		if meta := elements(e.Value); len(meta) > 0 && meta[0].Key == "$meta" {
+			continue // computed fields such as the text search score
+		}
+		if _, ok := v.lookup(e.Key); !ok {
+			v.unknown[e.Key] = struct{}{}
+		}
+	}
+}
+
+// pipeline checks the $match and $sort stages at the start of an aggregation,
+// before any stage changes the shape of the documents
+func (v *validator) pipeline(stages bson.A) {
+	for _, stage := range stages {
+		s := elements(stage)
+		if len(s) != 1 {
+			return
+		}
+
+		switch s[0].Key {
+		case "$match":
+			v.filter(s[0].Value, "")
+		case "$sort":
+			v.keys(s[0].Value)
+		case "$skip", "$limit":
+		default:
+			return
+		}
+	}
+}
+
+// lookup resolves a field path, ignoring array indexes and positional operators
+// and accepting any sub path of a map or interface field.
+func (v *validator) lookup(path string) (utils.Field, bool) {
+	var segments []string
+	for _, segment := range strings.Split(path, ".") {
+		if strings.HasPrefix(segment, "$") {
+			continue
+		}
+		if _, err := strconv.Atoi(segment); err == nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+
+	for i := len(segments); i > 0; i-- {
+		field, ok := v.fields[strings.Join(segments[:i], ".")]
+		if !ok {
+			continue
+		}
+		if i == len(segments) || field.Dynamic {
+			return field, true
+		}
+		return utils.Field{}, false
+	}
+
+	return utils.Field{}, false
+}
+
+type valueKind string
+
+const (
+	kindAny      valueKind = "any"
+	kindString   valueKind = "string"
+	kindNumber   valueKind = "number"
+	kindBool     valueKind = "bool"
+	kindTime     valueKind = "date"
+	kindObjectID valueKind = "objectId"
+	kindBinary   valueKind = "binary"
+	kindRegex    valueKind = "regex"
+	kindDocument valueKind = "document"
+	kindArray    valueKind = "array"
+)
+
+var (
+	objectIDType   = reflect.TypeOf(primitive.ObjectID{})
+	dateTimeType   = reflect.TypeOf(primitive.DateTime(0))
+	decimalType    = reflect.TypeOf(primitive.Decimal128{})
+	regexType      = reflect.TypeOf(primitive.Regex{})
+	binaryType     = reflect.TypeOf(primitive.Binary{})
+	timeType       = reflect.TypeOf(time.Time{})
+	primitiveDType = reflect.TypeOf(primitive.D{})
+)
+
+func kindOf(t reflect.Type) valueKind {
+	if t == nil {
+		return kindAny
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case objectIDType:
+		return kindObjectID
+	case timeType, dateTimeType:
+		return kindTime
+	case decimalType:
+		return kindNumber
+	case regexType:
+		return kindRegex
+	case binaryType:
+		return kindBinary
+	case primitiveDType:
+		return kindDocument
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return kindString
+	case reflect.Bool:
+		return kindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return kindNumber
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return kindBinary
+		}
+		return kindArray
+	case reflect.Struct, reflect.Map:
+		if utils.IsLeafStruct(t) {
+			return kindAny
+		}
+		return kindDocument
+	}
+
+	return kindAny
+}
+
+func elemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Elem()
+}
+
+// elements returns the key value pairs of a filter document in any of the supported forms
+func elements(doc any) []bson.E {
+	switch d := doc.(type) {
+	case bson.D:
+		return d
+	case Condition:
+		return bson.D(d)
+	case bson.M:
+		return sortedElements(d)
+	case map[string]any:
+		return sortedElements(d)
+	}
+	return nil
+}
+
+func sortedElements(m map[string]any) []bson.E {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	resp := make([]bson.E, 0, len(m))
+	for _, k := range keys {
+		resp = append(resp, bson.E{Key: k, Value: m[k]})
+	}
+	return resp
+}
+
+// items returns the elements of an array value in any of the supported forms
+func items(value any) []any {
+	if a, ok := value.(bson.A); ok {
+		return a
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+
+	resp := make([]any, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		resp = append(resp, rv.Index(i).Interface())
+	}
+	return resp
+}
+
+func modelType(model any) reflect.Type {
+	if model == nil {
+		return nil
+	}
+
+	t, ok := model.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(model)
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return t
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
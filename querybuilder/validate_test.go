@@ -0,0 +1,58 @@
+package querybuilder
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+)
+
+type validateModel struct {
+	ID     primitive.ObjectID   `bson:"_id"`
+	Tags   []string             `bson:"tags"`
+	Scores []int                `bson:"scores"`
+	Owners []primitive.ObjectID `bson:"owners"`
+	Name   string               `bson:"name"`
+}
+
+func TestValidateArrayValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     bson.D
+		mismatches []string
+	}{
+		{"typed slice on a slice field", bson.D{{"tags", []string{"a", "b"}}}, nil},
+		{"empty typed slice", bson.D{{"tags", []string{}}}, nil},
+		{"fixed size array", bson.D{{"scores", [2]int64{1, 2}}}, nil},
+		{"bson.A on a slice field", bson.D{{"tags", bson.A{"a", "b"}}}, nil},
+		{"element on a slice field", bson.D{{"tags", "a"}}, nil},
+		{"ObjectIDs on an ObjectID slice", bson.D{{"owners", []primitive.ObjectID{primitive.NewObjectID()}}}, nil},
+		{"ObjectID element", bson.D{{"owners", primitive.NewObjectID()}}, nil},
+		{"typed slice of another type", bson.D{{"tags", []int{1}}}, []string{"tags (number compared to string)"}},
+		{"empty typed slice of another type", bson.D{{"scores", []string{}}}, []string{"scores (string compared to number)"}},
+		{"bson.A with a mismatched element", bson.D{{"tags", bson.A{"a", 1}}}, []string{"tags (number compared to string)"}},
+		{"$eq with a typed slice", bson.D{{"tags", bson.D{{"$eq", []string{"a"}}}}}, nil},
+		{"slice on a scalar field", bson.D{{"name", []string{"a"}}}, []string{"name (array compared to string)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&Query{Filters: []bson.D{tt.filter}}, validateModel{})
+			if tt.mismatches == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("got %v, want a *ValidationError", err)
+			}
+			if !reflect.DeepEqual(validationErr.TypeMismatches, tt.mismatches) {
+				t.Errorf("got mismatches %v, want %v", validationErr.TypeMismatches, tt.mismatches)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/dinson/mongokit/querybuilder"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
 	"time"
 )
 
@@ -21,27 +22,88 @@ type Repository[T any] interface {
 	//
 	// To "Update" an existing record, pass the primary key objectID hex as "ID"
 	//
+	// Once saved, the id is also assigned to the "_id" field of the entity when it is empty.
+	//
 	// param: entity represents the model of the collection
 	Save(ctx context.Context, entity *T, ID *string) (*primitive.ObjectID, error)
 
 	// InsertMany can be used to insert multiple records into a collection.
+	//
+	// Documents are sent in ordered chunks, see InsertManyChunked for the defaults.
+	// On failure, the ids of the documents inserted before the failure are returned with the error.
+	//
+	// Generated ids are assigned to the "_id" field of the documents. Documents whose "_id" is not
+	// an ObjectID are inserted, but reported with a *NonObjectIDError.
 	InsertMany(ctx context.Context, docs []*T) ([]*primitive.ObjectID, error)
 
+	// InsertManyChunked inserts very large batches in chunks bounded by count and encoded size,
+	// optionally unordered and with concurrent chunk workers.
+	//
+	// The result reports the inserted id and the failure of each input index, so that a failed import
+	// can be resumed with the documents at InsertManyResult.FailedIndexes.
+	InsertManyChunked(ctx context.Context, docs []*T, opts *InsertManyOptions) (*InsertManyResult, error)
+
+	// BulkWrite runs mixed insert, update, replace and delete operations in a single batch.
+	//
+	// The result maps each failed operation index to a *WriteError. When some operations fail,
+	// both the result and an error are returned.
+	BulkWrite(ctx context.Context, ops []WriteModel[T], opts *BulkWriteOptions) (*BulkWriteResult, error)
+
 	// FindAll returns all the matching documents.
 	FindAll(ctx context.Context, query *querybuilder.Query) ([]*T, error)
 
 	// FindOne returns the first matching document.
 	FindOne(ctx context.Context, query *querybuilder.Query) (*T, error)
 
+	// Distinct returns the distinct values of key among the documents matching the query.
+	// A nil query matches every document.
+	//
+	// To decode the values into a typed slice, use DistinctAs.
+	Distinct(ctx context.Context, key querybuilder.KeyMongoDB, query *querybuilder.Query) ([]any, error)
+
+	// Aggregate runs the aggregation pipeline of the query and decodes the results into T.
+	//
+	// To decode results of a different shape, use AggregateAs.
+	Aggregate(ctx context.Context, query *querybuilder.Query) ([]*T, error)
+
+	// Populate fills the fields of docs declared with the ref struct tag from their related collection,
+	// with one query per field. Pass Go field names to populate only some of them.
+	// Related collections are found with WithRelatedCollections, in the database of the collection by default.
+	//
+	// Example:
+	//
+	// Author *User `bson:"-" ref:"users,localField=authorId"` is filled with the user whose _id is authorId
+	//
+	// Comments []*Comment `bson:"-" ref:"comments,localField=_id,foreignField=postId"` is filled with every matching comment
+	Populate(ctx context.Context, docs []*T, fields ...string) error
+
 	// DeleteOne deletes the first document that matches the query.
 	DeleteOne(ctx context.Context, query *querybuilder.Query) error
 
 	// DeleteMany deletes all documents matching the query.
 	DeleteMany(ctx context.Context, query *querybuilder.Query) error
+
+	// Watch opens a change stream on the collection, filtered by the query filters matched against
+	// the full document of each event. A nil query watches every change.
+	// The aggregate of the query may only hold $match stages, which are matched against the full document too.
+	//
+	// With a ResumeTokenStore in opts, the stream resumes after the last event the consumer was done with.
+	Watch(ctx context.Context, query *querybuilder.Query, opts *WatchOptions) (*ChangeStream[T], error)
+
+	// EnsureIndexes creates the indexes declared with the mongokit struct tag on T.
+	//
+	// With a CollectionResolver, the indexes are created on the collection resolved for ctx,
+	// call it once per tenant when provisioning a tenant.
+	//
+	// Supported tags:
+	//
+	// `mongokit:"2dsphere"` creates a 2dsphere index on a GeoJSON field
+	EnsureIndexes(ctx context.Context) error
 }
 
 type repositoryImpl[T any] struct {
-	collection *mongo.Collection
+	resolve CollectionResolver
+	config  repositoryConfig
 }
 
 /*
@@ -54,9 +116,65 @@ type repositoryImpl[T any] struct {
 		model := &Users{}
 
 		usersRepo := NewRepository[model](mongoCollectionObject)
+
+		Optional behaviour such as strict query validation is enabled with options:
+
+		usersRepo := NewRepository[model](mongoCollectionObject, WithStrictQueries())
 */
-func NewRepository[T any](collection *mongo.Collection) Repository[T] {
-	return &repositoryImpl[T]{
-		collection: collection,
+func NewRepository[T any](collection *mongo.Collection, opts ...Option) Repository[T] {
+	sameDatabase := func(ctx context.Context, name string) (*mongo.Collection, error) {
+		return collection.Database().Collection(name), nil
+	}
+
+	opts = append([]Option{WithRelatedCollections(sameDatabase)}, opts...)
+	return NewRepositoryWithResolver[T](StaticCollection(collection), opts...)
+}
+
+/*
+		NewRepositoryWithResolver initiates crud methods on the collection returned by resolver
+		for each operation, e.g. a collection per tenant.
+
+	 	Example usage:
+
+		resolver := DatabasePerTenant(mongoClient, "app_", "users")
+
+		usersRepo := NewRepositoryWithResolver[Users](resolver)
+
+		users, err := usersRepo.FindAll(WithTenant(ctx, "acme"), query) // reads app_acme.users
+
+		Populate reads related collections through WithRelatedCollections:
+
+		usersRepo := NewRepositoryWithResolver[Users](resolver, WithRelatedCollections(RelatedDatabasePerTenant(mongoClient, "app_")))
+*/
+func NewRepositoryWithResolver[T any](resolver CollectionResolver, opts ...Option) Repository[T] {
+	r := &repositoryImpl[T]{
+		resolve: resolver,
+	}
+
+	for _, opt := range opts {
+		opt(&r.config)
+	}
+
+	return r
+}
+
+func (r repositoryImpl[T]) keyProvider() KeyProvider {
+	return r.config.keys
+}
+
+// prepare validates the query and encrypts its filter values on encrypted fields, see WithEncryption.
+// It returns the query to run.
+func (r repositoryImpl[T]) prepare(ctx context.Context, query *querybuilder.Query) (*querybuilder.Query, error) {
+	if err := r.validate(query); err != nil {
+		return nil, err
+	}
+	return encryptQuery[T](ctx, r.config.keys, query)
+}
+
+// validate checks the query against the model when the repository runs in strict mode
+func (r repositoryImpl[T]) validate(query *querybuilder.Query) error {
+	if !r.config.strict {
+		return nil
 	}
+	return querybuilder.Validate(query, reflect.TypeOf((*T)(nil)).Elem())
 }
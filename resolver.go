@@ -0,0 +1,119 @@
+package mongokit
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"regexp"
+	"sync"
+)
+
+// tenantNamePattern restricts the tenants that can be part of a database or collection name
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,48}$`)
+
+// CollectionResolver returns the collection an operation runs against,
+// e.g. depending on the tenant of the context.
+type CollectionResolver func(ctx context.Context) (*mongo.Collection, error)
+
+// StaticCollection resolves every operation to the same collection
+func StaticCollection(collection *mongo.Collection) CollectionResolver {
+	return func(ctx context.Context) (*mongo.Collection, error) {
+		return collection, nil
+	}
+}
+
+// DatabasePerTenant resolves operations to the collection of a database dedicated to the tenant of the context,
+// named databasePrefix followed by the tenant, e.g. "app_acme" for the prefix "app_".
+func DatabasePerTenant(client *mongo.Client, databasePrefix, collection string) CollectionResolver {
+	return tenantResolver(func(tenantID string) *mongo.Collection {
+		return client.Database(databasePrefix + tenantID).Collection(collection)
+	})
+}
+
+// CollectionSuffix resolves operations to a collection of db dedicated to the tenant of the context,
+// named collectionPrefix followed by the tenant, e.g. "users_acme" for the prefix "users_".
+func CollectionSuffix(db *mongo.Database, collectionPrefix string) CollectionResolver {
+	return tenantResolver(func(tenantID string) *mongo.Collection {
+		return db.Collection(collectionPrefix + tenantID)
+	})
+}
+
+// RelatedCollectionResolver returns the collection Populate reads the related documents of a ref field from,
+// given the collection name of its ref tag.
+type RelatedCollectionResolver func(ctx context.Context, collection string) (*mongo.Collection, error)
+
+// WithRelatedCollections sets where Populate reads related documents from. Repositories created with
+// NewRepository read them from the database of their collection, repositories created with
+// NewRepositoryWithResolver need this option to populate, e.g. with the counterpart of their resolver.
+func WithRelatedCollections(resolver RelatedCollectionResolver) Option {
+	return func(r *repositoryConfig) {
+		r.related = resolver
+	}
+}
+
+// RelatedInDatabase resolves related collections by name in db
+func RelatedInDatabase(db *mongo.Database) RelatedCollectionResolver {
+	return func(ctx context.Context, collection string) (*mongo.Collection, error) {
+		return db.Collection(collection), nil
+	}
+}
+
+// RelatedDatabasePerTenant resolves related collections in the database of the tenant of the context,
+// the counterpart of DatabasePerTenant with the same databasePrefix.
+func RelatedDatabasePerTenant(client *mongo.Client, databasePrefix string) RelatedCollectionResolver {
+	return func(ctx context.Context, collection string) (*mongo.Collection, error) {
+		tenantID, err := tenantName(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return client.Database(databasePrefix + tenantID).Collection(collection), nil
+	}
+}
+
+// RelatedCollectionSuffix resolves related collections to the collection of db dedicated to the tenant of the context,
+// the collection name followed by separator and the tenant, e.g. "users_acme" for the separator "_".
+// It is the counterpart of CollectionSuffix.
+func RelatedCollectionSuffix(db *mongo.Database, separator string) RelatedCollectionResolver {
+	return func(ctx context.Context, collection string) (*mongo.Collection, error) {
+		tenantID, err := tenantName(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return db.Collection(collection + separator + tenantID), nil
+	}
+}
+
+// tenantResolver resolves the collection of the tenant of the context with build,
+// caching the handle of each tenant. Tenants are limited to letters, digits, '_' and '-'.
+func tenantResolver(build func(tenantID string) *mongo.Collection) CollectionResolver {
+	var cache sync.Map // map[string]*mongo.Collection
+
+	return func(ctx context.Context) (*mongo.Collection, error) {
+		tenantID, ok := TenantFromContext(ctx)
+		if !ok {
+			return nil, errMissingTenant
+		}
+
+		if collection, ok := cache.Load(tenantID); ok {
+			return collection.(*mongo.Collection), nil
+		}
+
+		if !tenantNamePattern.MatchString(tenantID) {
+			return nil, errInvalidTenant
+		}
+
+		collection, _ := cache.LoadOrStore(tenantID, build(tenantID))
+		return collection.(*mongo.Collection), nil
+	}
+}
+
+// tenantName returns the tenant of the context, validated like tenantResolver does
+func tenantName(ctx context.Context) (string, error) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return "", errMissingTenant
+	}
+	if !tenantNamePattern.MatchString(tenantID) {
+		return "", errInvalidTenant
+	}
+	return tenantID, nil
+}
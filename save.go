@@ -8,7 +8,17 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// scopedSaver saves with additional conditions in the update filter, so that Save cannot
+// take over a document that does not match them, see tenantRepository.Save.
+type scopedSaver[T any] interface {
+	saveScoped(ctx context.Context, entity *T, ID *string, scope bson.D) (*primitive.ObjectID, error)
+}
+
 func (r repositoryImpl[T]) Save(ctx context.Context, entity *T, ID *string) (*primitive.ObjectID, error) {
+	return r.saveScoped(ctx, entity, ID, nil)
+}
+
+func (r repositoryImpl[T]) saveScoped(ctx context.Context, entity *T, ID *string, scope bson.D) (*primitive.ObjectID, error) {
 	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
 	defer cancel()
 
@@ -21,18 +31,32 @@ func (r repositoryImpl[T]) Save(ctx context.Context, entity *T, ID *string) (*pr
 		objectID = *oID
 	}
 
+	// encrypt a copy, the caller keeps the plaintext entity
+	doc, err := encryptDoc(newCtx, r.config.keys, entity)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := options.Update().SetUpsert(true)
-	filter := bson.D{{"_id", objectID}}
+	filter := append(bson.D{{"_id", objectID}}, scope...)
+
+	collection, err := r.resolve(newCtx)
+	if err != nil {
+		return nil, err
+	}
 
-	res, err := r.collection.UpdateOne(newCtx, filter, bson.D{{"$set", entity}}, opts)
+	res, err := collection.UpdateOne(newCtx, filter, bson.D{{"$set", doc}}, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	oid := objectID
-	if res.UpsertedID != nil {
-		oid = res.UpsertedID.(primitive.ObjectID)
+	if upsertedID, ok := res.UpsertedID.(primitive.ObjectID); ok {
+		oid = upsertedID
 	}
 
+	// fill the id back into the entity once it is saved, so callers do not have to copy the returned id over
+	setID(entity, oid)
+
 	return &oid, nil
 }
@@ -0,0 +1,29 @@
+package mongokit
+
+import (
+	"github.com/dinson/mongokit/utils"
+	"strings"
+)
+
+const (
+	tagName = "mongokit"
+
+	tag2DSphere = "2dsphere"
+)
+
+// tagOptions returns the options of the mongokit struct tag of a field, e.g. `mongokit:"2dsphere"`
+func tagOptions(field utils.Field) map[string]bool {
+	tag, ok := field.Tag.Lookup(tagName)
+	if !ok {
+		return nil
+	}
+
+	opts := map[string]bool{}
+	for _, opt := range strings.Split(tag, ",") {
+		if opt = strings.TrimSpace(opt); opt != "" {
+			opts[opt] = true
+		}
+	}
+
+	return opts
+}
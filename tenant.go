@@ -0,0 +1,349 @@
+package mongokit
+
+import (
+	"context"
+	"fmt"
+	"github.com/dinson/mongokit/querybuilder"
+	"github.com/dinson/mongokit/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+)
+
+const defaultTenantField querybuilder.KeyMongoDB = "tenantId"
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose repository operations are scoped to tenantID
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant set with WithTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+type TenantOptions struct {
+	// Field is the bson path of the tenant id in the documents. Defaults to "tenantId".
+	Field querybuilder.KeyMongoDB
+}
+
+type tenantRepository[T any] struct {
+	Repository[T]
+	field querybuilder.KeyMongoDB
+	index []int
+}
+
+/*
+		NewTenantRepository wraps repo so that every operation is scoped to the tenant of the context,
+		set with WithTenant. Operations fail when the context carries no tenant.
+
+		The tenant is added to the filters, RawQuery and BatchFilters of every query, matched at the start
+		of aggregation pipelines, and stamped on every inserted or saved document. $lookup and $unionWith
+		stages read other collections and are not scoped, Populate is not supported for the same reason.
+
+		T must have a string field encoded as the tenant field, NewTenantRepository panics otherwise.
+		It also panics when repo is created WithPopulate.
+
+	 	Example usage:
+
+		type Invoice struct {
+			ID       *primitive.ObjectID `bson:"_id,omitempty"`
+			TenantID string              `bson:"tenantId"`
+			Total    int64               `bson:"total"`
+		}
+
+		invoicesRepo := NewTenantRepository(NewRepository[Invoice](db.Collection("invoices")), nil)
+
+		invoices, err := invoicesRepo.FindAll(WithTenant(ctx, "acme"), query)
+*/
+func NewTenantRepository[T any](repo Repository[T], opts *TenantOptions) Repository[T] {
+	field := defaultTenantField
+	if opts != nil && opts.Field != "" {
+		field = opts.Field
+	}
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+
+	var index []int
+	for _, f := range utils.BSONFields(t) {
+		if f.Path == field.String() && f.Index != nil && f.Type.Kind() == reflect.String {
+			index = f.Index
+			break
+		}
+	}
+	if index == nil {
+		panic(fmt.Errorf("%w: %s has no string field %q", errMissingTenantField, t, field))
+	}
+	if p, ok := repo.(autoPopulater); ok && p.autoPopulates() {
+		// the finds of repo would populate without the tenant filter, see Populate
+		panic(fmt.Errorf("%w: repo is created WithPopulate", errUnscopedPopulate))
+	}
+
+	return &tenantRepository[T]{
+		Repository: repo,
+		field:      field,
+		index:      index,
+	}
+}
+
+// Save stamps the tenant on entity and saves it. Saving over the _id of a document of another tenant
+// fails with a duplicate key error, as the tenant is part of the filter of the upsert.
+func (r tenantRepository[T]) Save(ctx context.Context, entity *T, ID *string) (*primitive.ObjectID, error) {
+	tenantID, err := r.stamp(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	saver, ok := r.Repository.(scopedSaver[T])
+	if !ok {
+		return nil, errUnsupportedRepository
+	}
+
+	return saver.saveScoped(ctx, entity, ID, bson.D{{r.field.String(), tenantID}})
+}
+
+func (r tenantRepository[T]) InsertMany(ctx context.Context, docs []*T) ([]*primitive.ObjectID, error) {
+	if err := r.stampAll(ctx, docs); err != nil {
+		return nil, err
+	}
+	return r.Repository.InsertMany(ctx, docs)
+}
+
+func (r tenantRepository[T]) InsertManyChunked(ctx context.Context, docs []*T, opts *InsertManyOptions) (*InsertManyResult, error) {
+	if err := r.stampAll(ctx, docs); err != nil {
+		return nil, err
+	}
+	return r.Repository.InsertManyChunked(ctx, docs, opts)
+}
+
+func (r tenantRepository[T]) BulkWrite(ctx context.Context, ops []WriteModel[T], opts *BulkWriteOptions) (*BulkWriteResult, error) {
+	scoped := make([]WriteModel[T], len(ops))
+
+	for i, op := range ops {
+		if op.doc != nil {
+			if _, err := r.stamp(ctx, op.doc); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		}
+		if op.query != nil {
+			query, err := r.scope(ctx, op.query)
+			if err != nil {
+				return nil, err
+			}
+			op.query = query
+		}
+		scoped[i] = op
+	}
+
+	return r.Repository.BulkWrite(ctx, scoped, opts)
+}
+
+func (r tenantRepository[T]) FindAll(ctx context.Context, query *querybuilder.Query) ([]*T, error) {
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return r.Repository.FindAll(ctx, scoped)
+}
+
+func (r tenantRepository[T]) FindOne(ctx context.Context, query *querybuilder.Query) (*T, error) {
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return r.Repository.FindOne(ctx, scoped)
+}
+
+func (r tenantRepository[T]) Distinct(ctx context.Context, key querybuilder.KeyMongoDB, query *querybuilder.Query) ([]any, error) {
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return r.Repository.Distinct(ctx, key, scoped)
+}
+
+func (r tenantRepository[T]) Aggregate(ctx context.Context, query *querybuilder.Query) ([]*T, error) {
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return r.Repository.Aggregate(ctx, scoped)
+}
+
+// Populate is not supported: the related collections are read without the tenant filter,
+// so it could fill documents with the data of other tenants. Populate with the repositories
+// of the related models instead.
+func (r tenantRepository[T]) Populate(ctx context.Context, docs []*T, fields ...string) error {
+	return errUnscopedPopulate
+}
+
+func (r tenantRepository[T]) DeleteOne(ctx context.Context, query *querybuilder.Query) error {
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return err
+	}
+	return r.Repository.DeleteOne(ctx, scoped)
+}
+
+func (r tenantRepository[T]) DeleteMany(ctx context.Context, query *querybuilder.Query) error {
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return err
+	}
+	return r.Repository.DeleteMany(ctx, scoped)
+}
+
+// Watch scopes the change stream to the tenant. Delete events carry no full document and are not delivered.
+func (r tenantRepository[T]) Watch(ctx context.Context, query *querybuilder.Query, opts *WatchOptions) (*ChangeStream[T], error) {
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return r.Repository.Watch(ctx, scoped, opts)
+}
+
+func (r tenantRepository[T]) findCursor(ctx context.Context, query *querybuilder.Query) (*mongo.Cursor, error) {
+	finder, ok := r.Repository.(cursorFinder)
+	if !ok {
+		return nil, errUnsupportedRepository
+	}
+
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return finder.findCursor(ctx, scoped)
+}
+
+func (r tenantRepository[T]) aggregateCursor(ctx context.Context, query *querybuilder.Query) (*mongo.Cursor, error) {
+	finder, ok := r.Repository.(cursorFinder)
+	if !ok {
+		return nil, errUnsupportedRepository
+	}
+
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return finder.aggregateCursor(ctx, scoped)
+}
+
+func (r tenantRepository[T]) keyProvider() KeyProvider {
+	if finder, ok := r.Repository.(cursorFinder); ok {
+		return finder.keyProvider()
+	}
+	return nil
+}
+
+func (r tenantRepository[T]) tenant(ctx context.Context) (string, error) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return "", errMissingTenant
+	}
+	return tenantID, nil
+}
+
+// scope returns a copy of the query restricted to the tenant of the context. A nil query matches every document of the tenant.
+func (r tenantRepository[T]) scope(ctx context.Context, query *querybuilder.Query) (*querybuilder.Query, error) {
+	tenantID, err := r.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantFilter := bson.D{{r.field.String(), tenantID}}
+
+	scoped := &querybuilder.Query{Options: options.Find()}
+	if query != nil {
+		*scoped = *query
+	}
+
+	if scoped.RawQuery != nil || scoped.BatchFilters != nil {
+		original := scoped.GetFilter()
+
+		if scoped.RawQuery != nil {
+			scoped.RawQuery = bson.D{{"$and", bson.A{original, tenantFilter}}}
+		} else {
+			scoped.BatchFilters = bson.M{"$and": bson.A{original, tenantFilter}}
+		}
+
+		// deletes only read Filters, keep them equivalent to the filter used by finds
+		scoped.Filters = []bson.D{{{"$and", bson.A{original}}}, tenantFilter}
+	} else {
+		filters := make([]bson.D, 0, len(scoped.Filters)+1)
+		filters = append(filters, scoped.Filters...)
+		scoped.Filters = append(filters, tenantFilter)
+	}
+
+	// an empty pipeline runs as well, it has to match the tenant too
+	scoped.Aggregate = scopePipeline(scoped.Aggregate, tenantFilter)
+
+	return scoped, nil
+}
+
+// scopePipeline matches the tenant at the start of the pipeline, after a $geoNear stage which has to come first
+func scopePipeline(pipeline bson.A, tenantFilter bson.D) bson.A {
+	at := 0
+	if len(pipeline) > 0 && stageName(pipeline[0]) == "$geoNear" {
+		at = 1
+	}
+
+	scoped := make(bson.A, 0, len(pipeline)+1)
+	scoped = append(scoped, pipeline[:at]...)
+	scoped = append(scoped, bson.D{{"$match", tenantFilter}})
+	return append(scoped, pipeline[at:]...)
+}
+
+func stageName(stage any) string {
+	switch s := stage.(type) {
+	case bson.D:
+		if len(s) > 0 {
+			return s[0].Key
+		}
+	case bson.M:
+		for key := range s {
+			return key
+		}
+	}
+	return ""
+}
+
+// stamp sets the tenant of the context on doc, failing when doc already belongs to another tenant
+func (r tenantRepository[T]) stamp(ctx context.Context, doc *T) (string, error) {
+	tenantID, err := r.tenant(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if doc == nil {
+		return "", errNilDocument
+	}
+
+	field, err := reflect.ValueOf(doc).Elem().FieldByIndexErr(r.index)
+	if err != nil {
+		return "", err
+	}
+
+	switch current := field.String(); current {
+	case tenantID:
+	case "":
+		field.SetString(tenantID)
+	default:
+		return "", errTenantMismatch
+	}
+
+	return tenantID, nil
+}
+
+func (r tenantRepository[T]) stampAll(ctx context.Context, docs []*T) error {
+	for i, doc := range docs {
+		if _, err := r.stamp(ctx, doc); err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	return nil
+}
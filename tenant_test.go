@@ -0,0 +1,155 @@
+package mongokit
+
+import (
+	"context"
+	"errors"
+	"github.com/dinson/mongokit/querybuilder"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+type tenantDoc struct {
+	ID       any    `bson:"_id,omitempty"`
+	TenantID string `bson:"tenantId"`
+	Total    int64  `bson:"total"`
+}
+
+func newTestTenantRepository() tenantRepository[tenantDoc] {
+	return *NewTenantRepository[tenantDoc](nil, nil).(*tenantRepository[tenantDoc])
+}
+
+func extJSON(t *testing.T, value any) string {
+	t.Helper()
+
+	data, err := bson.MarshalExtJSON(bson.D{{"v", value}}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestTenantScopeFilters(t *testing.T) {
+	r := newTestTenantRepository()
+	ctx := WithTenant(context.Background(), "acme")
+
+	query, err := querybuilder.New().Where(querybuilder.Gte("total", 10)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scoped, err := r.scope(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"v":{"$and":[{"total":{"$gte":10}},{"tenantId":"acme"}]}}`
+	if got := extJSON(t, scoped.GetFilter()); got != want {
+		t.Errorf("filter: got %s, want %s", got, want)
+	}
+	if len(query.Filters) != 1 {
+		t.Errorf("the query of the caller was changed: %v", query.Filters)
+	}
+}
+
+func TestTenantScopeRawQueryAndBatchFilters(t *testing.T) {
+	r := newTestTenantRepository()
+	ctx := WithTenant(context.Background(), "acme")
+
+	for name, query := range map[string]*querybuilder.Query{
+		"raw query":     {RawQuery: bson.D{{"total", 5}}},
+		"batch filters": {BatchFilters: bson.M{"total": 5}},
+	} {
+		scoped, err := r.scope(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := `{"v":{"$and":[{"total":5},{"tenantId":"acme"}]}}`
+		if got := extJSON(t, scoped.GetFilter()); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+
+		// deletes only read Filters, they must match the same documents
+		wantDelete := `{"v":{"$and":[{"$and":[{"total":5}]},{"tenantId":"acme"}]}}`
+		if got := extJSON(t, bson.D{{"$and", scoped.Filters}}); got != wantDelete {
+			t.Errorf("%s: delete filter %s, want %s", name, got, wantDelete)
+		}
+	}
+}
+
+func TestTenantScopePipelines(t *testing.T) {
+	r := newTestTenantRepository()
+	ctx := WithTenant(context.Background(), "acme")
+
+	tests := []struct {
+		name     string
+		pipeline bson.A
+		want     string
+	}{
+		{
+			name: "nil query",
+			want: `{"v":[{"$match":{"tenantId":"acme"}}]}`,
+		},
+		{
+			name:     "empty pipeline",
+			pipeline: bson.A{},
+			want:     `{"v":[{"$match":{"tenantId":"acme"}}]}`,
+		},
+		{
+			name:     "pipeline",
+			pipeline: bson.A{bson.D{{"$group", bson.D{{"_id", "$status"}}}}},
+			want:     `{"v":[{"$match":{"tenantId":"acme"}},{"$group":{"_id":"$status"}}]}`,
+		},
+		{
+			name:     "$geoNear first",
+			pipeline: bson.A{bson.D{{"$geoNear", bson.D{{"distanceField", "d"}}}}, bson.D{{"$limit", 5}}},
+			want:     `{"v":[{"$geoNear":{"distanceField":"d"}},{"$match":{"tenantId":"acme"}},{"$limit":5}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		var query *querybuilder.Query
+		if tt.pipeline != nil {
+			query = &querybuilder.Query{Aggregate: tt.pipeline}
+		}
+
+		scoped, err := r.scope(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := extJSON(t, scoped.Aggregate); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTenantScopeWithoutTenant(t *testing.T) {
+	r := newTestTenantRepository()
+
+	if _, err := r.scope(context.Background(), nil); !errors.Is(err, errMissingTenant) {
+		t.Errorf("got %v, want %v", err, errMissingTenant)
+	}
+}
+
+func TestTenantStamp(t *testing.T) {
+	r := newTestTenantRepository()
+	ctx := WithTenant(context.Background(), "acme")
+
+	doc := &tenantDoc{}
+	if _, err := r.stamp(ctx, doc); err != nil || doc.TenantID != "acme" {
+		t.Errorf("empty tenant: got %q, %v", doc.TenantID, err)
+	}
+
+	if _, err := r.stamp(ctx, &tenantDoc{TenantID: "acme"}); err != nil {
+		t.Errorf("same tenant: %v", err)
+	}
+
+	other := &tenantDoc{TenantID: "globex"}
+	if _, err := r.stamp(ctx, other); !errors.Is(err, errTenantMismatch) || other.TenantID != "globex" {
+		t.Errorf("other tenant: got %q, %v", other.TenantID, err)
+	}
+
+	if _, err := r.stamp(ctx, nil); !errors.Is(err, errNilDocument) {
+		t.Errorf("nil document: got %v", err)
+	}
+}
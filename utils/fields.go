@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field describes a single bson encoded field of a struct
+type Field struct {
+	Path    string            // dotted bson path from the root struct, e.g. "address.city"
+	Name    string            // bson name of the field itself, e.g. "city"
+	Type    reflect.Type      // Go type of the field
+	Index   []int             // index sequence for reflect.Value.FieldByIndex, nil when the field is reached through a slice, array or map
+	Tag     reflect.StructTag // full struct tag of the field
+	InArray bool              // true when the field is reached through a slice or array
+	Dynamic bool              // true for maps and interfaces, whose sub paths are not known up front
+}
+
+var fieldCache sync.Map // map[reflect.Type][]Field
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	primitivePath = "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BSONFields returns every field of the struct type t as the mongo driver encodes it,
+// including fields of nested structs with their dotted paths.
+//
+// Pointers to structs are dereferenced. Results are cached per type.
+func BSONFields(t reflect.Type) []Field {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]Field)
+	}
+
+	var fields []Field
+	walkFields(t, "", nil, false, map[reflect.Type]bool{t: true}, &fields)
+
+	cached, _ := fieldCache.LoadOrStore(t, fields)
+	return cached.([]Field)
+}
+
+// ParseBSONTag splits a bson struct tag such as `name,omitempty` into its name and options
+func ParseBSONTag(tag string) (name string, opts []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+// IsLeafStruct reports whether a struct type is encoded as a single bson value,
+// such as time.Time or the primitive types, instead of as a sub document.
+func IsLeafStruct(t reflect.Type) bool {
+	return t == timeType || t.PkgPath() == primitivePath
+}
+
+func walkFields(t reflect.Type, prefix string, index []int, inArray bool, visiting map[reflect.Type]bool, fields *[]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag := sf.Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := ParseBSONTag(tag)
+		inline := false
+		for _, opt := range opts {
+			if opt == "inline" {
+				inline = true
+			}
+		}
+
+		var fieldIndex []int
+		if !inArray {
+			fieldIndex = append(append([]int{}, index...), i)
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		if inline && ft.Kind() == reflect.Struct {
+			if !visiting[ft] {
+				visiting[ft] = true
+				walkFields(ft, prefix, fieldIndex, inArray, visiting, fields)
+				delete(visiting, ft)
+			}
+			continue
+		}
+
+		if name == "" {
+			// the driver lowercases the field name when no bson name is given
+			name = strings.ToLower(sf.Name)
+		}
+
+		field := Field{
+			Path:    prefix + name,
+			Name:    name,
+			Type:    sf.Type,
+			Index:   fieldIndex,
+			Tag:     sf.Tag,
+			InArray: inArray,
+		}
+
+		nested, nestedInArray := ft, inArray
+		if (nested.Kind() == reflect.Slice || nested.Kind() == reflect.Array) && nested.Elem().Kind() != reflect.Uint8 {
+			nested, nestedInArray = nested.Elem(), true
+			for nested.Kind() == reflect.Pointer {
+				nested = nested.Elem()
+			}
+		}
+
+		switch nested.Kind() {
+		case reflect.Map, reflect.Interface:
+			field.Dynamic = true
+		}
+
+		*fields = append(*fields, field)
+
+		if nested.Kind() == reflect.Struct && !IsLeafStruct(nested) && !visiting[nested] {
+			nestedIndex := fieldIndex
+			if nestedInArray {
+				nestedIndex = nil
+			}
+			visiting[nested] = true
+			walkFields(nested, field.Path+".", nestedIndex, nestedInArray, visiting, fields)
+			delete(visiting, nested)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package mongokit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dinson/mongokit/querybuilder"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type OperationType string
+
+const (
+	OperationInsert     OperationType = "insert"
+	OperationUpdate     OperationType = "update"
+	OperationReplace    OperationType = "replace"
+	OperationDelete     OperationType = "delete"
+	OperationDrop       OperationType = "drop"
+	OperationRename     OperationType = "rename"
+	OperationInvalidate OperationType = "invalidate"
+)
+
+// ChangeEvent is a change stream event of a collection of T
+type ChangeEvent[T any] struct {
+	ResumeToken       bson.Raw            `bson:"_id"`
+	OperationType     OperationType       `bson:"operationType"`
+	FullDocument      *T                  `bson:"fullDocument"` // nil for deletes, and for updates of documents deleted since
+	DocumentKey       bson.Raw            `bson:"documentKey"`  // _id, and shard key for sharded collections
+	UpdateDescription *UpdateDescription  `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+	Namespace         Namespace           `bson:"ns"`
+}
+
+type UpdateDescription struct {
+	UpdatedFields   bson.Raw   `bson:"updatedFields"`
+	RemovedFields   []string   `bson:"removedFields"`
+	TruncatedArrays []bson.Raw `bson:"truncatedArrays"`
+}
+
+type Namespace struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"coll"`
+}
+
+// ResumeTokenStore persists the resume token of named change streams,
+// so that consumers restart where they left off.
+type ResumeTokenStore interface {
+	// Load returns the stored token of the stream, or nil when there is none
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	// Save stores the token of the stream
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+type WatchOptions struct {
+	// Name identifies the stream in Store. Required when Store is set.
+	Name string
+	// Store persists resume tokens. Without a store, the stream starts from the current time.
+	Store ResumeTokenStore
+	// OperationTypes limits the events to the given operations, all operations by default
+	OperationTypes []OperationType
+	// FullDocument defaults to options.UpdateLookup, so update events carry the current document
+	FullDocument options.FullDocument
+	// BatchSize of the underlying cursor, the server default when 0
+	BatchSize int32
+}
+
+// ChangeStream iterates over typed change events.
+//
+// The resume token of an event is saved to the ResumeTokenStore when Next is called again,
+// that is once the consumer is done with the event, or explicitly with Commit.
+type ChangeStream[T any] struct {
+	stream  *mongo.ChangeStream
+	store   ResumeTokenStore
+	name    string
+	event   *ChangeEvent[T]
+	pending bson.Raw
+	keys    KeyProvider
+	err     error
+}
+
+func (r repositoryImpl[T]) Watch(ctx context.Context, query *querybuilder.Query, opts *WatchOptions) (*ChangeStream[T], error) {
+	o := WatchOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Store != nil && o.Name == "" {
+		return nil, errMissingStreamName
+	}
+	if o.FullDocument == "" {
+		o.FullDocument = options.UpdateLookup
+	}
+
+	query, err := r.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline, err := watchPipeline(query, o.OperationTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	streamOpts := options.ChangeStream().SetFullDocument(o.FullDocument)
+	if o.BatchSize > 0 {
+		streamOpts.SetBatchSize(o.BatchSize)
+	}
+
+	if o.Store != nil {
+		loadCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+		token, err := o.Store.Load(loadCtx, o.Name)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if token != nil {
+			streamOpts.SetStartAfter(token)
+		}
+	}
+
+	collection, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := collection.Watch(ctx, pipeline, streamOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChangeStream[T]{
+		stream: stream,
+		store:  o.Store,
+		name:   o.Name,
+		keys:   r.config.keys,
+	}, nil
+}
+
+// Next blocks until the next event is available, and reports whether there is one.
+// It returns false when ctx is done or the stream failed, see Err.
+func (s *ChangeStream[T]) Next(ctx context.Context) bool {
+	if err := s.Commit(ctx); err != nil {
+		s.err = err
+		return false
+	}
+
+	if !s.stream.Next(ctx) {
+		s.err = s.stream.Err()
+		return false
+	}
+
+	var event ChangeEvent[T]
+	if err := s.stream.Decode(&event); err != nil {
+		s.err = err
+		return false
+	}
+	if err := decryptDocs(ctx, s.keys, event.FullDocument); err != nil {
+		s.err = err
+		return false
+	}
+
+	s.event = &event
+	s.pending = event.ResumeToken
+	return true
+}
+
+// Event returns the current event
+func (s *ChangeStream[T]) Event() *ChangeEvent[T] {
+	return s.event
+}
+
+// Err returns the error that stopped Next, if any
+func (s *ChangeStream[T]) Err() error {
+	return s.err
+}
+
+// Commit saves the resume token of the current event, if it was not saved yet
+func (s *ChangeStream[T]) Commit(ctx context.Context) error {
+	if s.store == nil || s.pending == nil {
+		return nil
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, connectionTimeout)
+	defer cancel()
+
+	if err := s.store.Save(newCtx, s.name, s.pending); err != nil {
+		return err
+	}
+
+	s.pending = nil
+	return nil
+}
+
+// Close closes the stream without saving the token of the current event
+func (s *ChangeStream[T]) Close(ctx context.Context) error {
+	return s.stream.Close(ctx)
+}
+
+// watchPipeline matches the operation types and the filters of the query against the full document of events.
+// Documents no longer exist in delete events, so a query with filters does not match them.
+//
+// Only $match stages are supported in the aggregate of the query, their filters are matched against the
+// full document as well, e.g. the tenant stage added by NewTenantRepository.
+func watchPipeline(query *querybuilder.Query, operationTypes []OperationType) (mongo.Pipeline, error) {
+	var match bson.A
+
+	if len(operationTypes) > 0 {
+		match = append(match, bson.D{{"operationType", bson.D{{"$in", operationTypes}}}})
+	}
+
+	if query != nil {
+		filter, err := prefixFields(query.GetFilter(), "fullDocument.")
+		if err != nil {
+			return nil, err
+		}
+		if len(filter) > 0 {
+			match = append(match, filter)
+		}
+	}
+
+	pipeline := mongo.Pipeline{}
+	if len(match) > 0 {
+		pipeline = append(pipeline, bson.D{{"$match", bson.D{{"$and", match}}}})
+	}
+
+	if query == nil {
+		return pipeline, nil
+	}
+
+	for _, stage := range query.Aggregate {
+		var filter any
+		switch s := stage.(type) {
+		case bson.D:
+			if len(s) != 1 || s[0].Key != "$match" {
+				return nil, fmt.Errorf("%w: %s", errUnsupportedWatchStage, stageName(s))
+			}
+			filter = s[0].Value
+		case bson.M:
+			if len(s) != 1 || s["$match"] == nil {
+				return nil, fmt.Errorf("%w: %s", errUnsupportedWatchStage, stageName(s))
+			}
+			filter = s["$match"]
+		default:
+			return nil, fmt.Errorf("%w: %T", errUnsupportedWatchStage, stage)
+		}
+
+		prefixed, err := prefixFields(filter, "fullDocument.")
+		if err != nil {
+			return nil, err
+		}
+		if len(prefixed) > 0 {
+			pipeline = append(pipeline, bson.D{{"$match", prefixed}})
+		}
+	}
+
+	return pipeline, nil
+}
+
+// prefixFields rewrites the field keys of a filter with prefix, descending into $and, $or and $nor,
+// and the field paths of $expr. Returns nil for an empty filter.
+//
+// Other top level operators such as $where or $text cannot be rewritten and are rejected.
+func prefixFields(filter any, prefix string) (bson.D, error) {
+	var elements bson.D
+	switch f := filter.(type) {
+	case nil:
+		return nil, nil
+	case bson.D:
+		elements = f
+	case bson.M:
+		for k, v := range f {
+			elements = append(elements, bson.E{k, v})
+		}
+	default:
+		raw, err := bson.Marshal(filter)
+		if err != nil {
+			return nil, err
+		}
+		if err = bson.Unmarshal(raw, &elements); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := make(bson.D, 0, len(elements))
+	for _, e := range elements {
+		switch {
+		case e.Key == "$and" || e.Key == "$or" || e.Key == "$nor":
+			group, ok := toArray(e.Value)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s must be an array", errUnsupportedWatchFilter, e.Key)
+			}
+			var items bson.A
+			for _, item := range group {
+				prefixed, err := prefixFields(item, prefix)
+				if err != nil {
+					return nil, err
+				}
+				if len(prefixed) > 0 {
+					items = append(items, prefixed)
+				}
+			}
+			if len(items) > 0 {
+				resp = append(resp, bson.E{e.Key, items})
+			}
+		case e.Key == "$expr":
+			resp = append(resp, bson.E{e.Key, prefixPaths(e.Value, prefix)})
+		case e.Key == "$comment":
+			resp = append(resp, e)
+		case strings.HasPrefix(e.Key, "$"):
+			return nil, fmt.Errorf("%w: %s", errUnsupportedWatchFilter, e.Key)
+		default:
+			resp = append(resp, bson.E{prefix + e.Key, e.Value})
+		}
+	}
+
+	if len(resp) == 0 {
+		return nil, nil
+	}
+	return resp, nil
+}
+
+// prefixPaths rewrites the field paths of an aggregation expression with prefix, e.g. "$total"
+// becomes "$fullDocument.total". Variables such as "$$ROOT" and $literal values are kept.
+func prefixPaths(expr any, prefix string) any {
+	switch v := expr.(type) {
+	case string:
+		if strings.HasPrefix(v, "$") && !strings.HasPrefix(v, "$$") {
+			return "$" + prefix + v[1:]
+		}
+		return v
+	case bson.D:
+		resp := make(bson.D, 0, len(v))
+		for _, e := range v {
+			if e.Key == "$literal" {
+				resp = append(resp, e)
+				continue
+			}
+			resp = append(resp, bson.E{e.Key, prefixPaths(e.Value, prefix)})
+		}
+		return resp
+	case bson.M:
+		resp := make(bson.M, len(v))
+		for k, item := range v {
+			if k == "$literal" {
+				resp[k] = item
+				continue
+			}
+			resp[k] = prefixPaths(item, prefix)
+		}
+		return resp
+	}
+
+	if items, ok := toArray(expr); ok {
+		resp := make(bson.A, 0, len(items))
+		for _, item := range items {
+			resp = append(resp, prefixPaths(item, prefix))
+		}
+		return resp
+	}
+	return expr
+}
+
+// toArray returns the elements of a slice or array value, other than bson.D
+func toArray(value any) (bson.A, bool) {
+	if _, ok := value.(bson.D); ok {
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	items := make(bson.A, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		items = append(items, rv.Index(i).Interface())
+	}
+	return items, true
+}
+
+type resumeToken struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+type mongoResumeTokenStore struct {
+	collection *mongo.Collection
+}
+
+// NewResumeTokenStore stores resume tokens in a collection, one document per stream name
+func NewResumeTokenStore(collection *mongo.Collection) ResumeTokenStore {
+	return &mongoResumeTokenStore{
+		collection: collection,
+	}
+}
+
+func (s *mongoResumeTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	var token resumeToken
+
+	err := s.collection.FindOne(ctx, bson.D{{"_id", name}}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token.Token, nil
+}
+
+func (s *mongoResumeTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	update := bson.D{{"$set", bson.D{{"token", token}, {"updatedAt", time.Now().UTC()}}}}
+
+	_, err := s.collection.UpdateOne(ctx, bson.D{{"_id", name}}, update, options.Update().SetUpsert(true))
+	return err
+}
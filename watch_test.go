@@ -0,0 +1,97 @@
+package mongokit
+
+import (
+	"context"
+	"errors"
+	"github.com/dinson/mongokit/querybuilder"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestWatchPipelineFilters(t *testing.T) {
+	query := &querybuilder.Query{Filters: []bson.D{{{"status", "published"}}}}
+
+	pipeline, err := watchPipeline(query, []OperationType{OperationInsert})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"v":[{"$match":{"$and":[{"operationType":{"$in":["insert"]}},{"$and":[{"fullDocument.status":"published"}]}]}}]}`
+	if got := extJSON(t, pipeline); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWatchPipelineTenant(t *testing.T) {
+	r := newTestTenantRepository()
+	ctx := WithTenant(context.Background(), "acme")
+
+	query, err := r.scope(ctx, &querybuilder.Query{
+		Aggregate: bson.A{bson.M{"$match": bson.M{"total": bson.M{"$gt": 10}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline, err := watchPipeline(query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every stage matches the full document, including the tenant stage added by scope
+	want := `{"v":[{"$match":{"$and":[{"$and":[{"fullDocument.tenantId":"acme"}]}]}},{"$match":{"fullDocument.tenantId":"acme"}},{"$match":{"fullDocument.total":{"$gt":10}}}]}`
+	if got := extJSON(t, pipeline); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWatchPipelineExpr(t *testing.T) {
+	query := &querybuilder.Query{RawQuery: bson.D{{"$expr", bson.D{{"$gt", bson.A{"$total", "$$limit", bson.D{{"$literal", "$price"}}}}}}}}
+
+	pipeline, err := watchPipeline(query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"v":[{"$match":{"$and":[{"$expr":{"$gt":["$fullDocument.total","$$limit",{"$literal":"$price"}]}}]}}]}`
+	if got := extJSON(t, pipeline); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWatchPipelineGroups(t *testing.T) {
+	query := &querybuilder.Query{RawQuery: bson.M{"$or": []bson.M{{"a": 1}, {"b": 2}}}}
+
+	pipeline, err := watchPipeline(query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"v":[{"$match":{"$and":[{"$or":[{"fullDocument.a":1},{"fullDocument.b":2}]}]}}]}`
+	if got := extJSON(t, pipeline); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWatchPipelineRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *querybuilder.Query
+		err   error
+	}{
+		{"project stage", &querybuilder.Query{Aggregate: bson.A{bson.D{{"$project", bson.D{{"a", 1}}}}}}, errUnsupportedWatchStage},
+		{"bson.M project stage", &querybuilder.Query{Aggregate: bson.A{bson.M{"$project": bson.M{"a": 1}}}}, errUnsupportedWatchStage},
+		{"stage of unknown type", &querybuilder.Query{Aggregate: bson.A{"$match"}}, errUnsupportedWatchStage},
+		{"$where filter", &querybuilder.Query{RawQuery: bson.D{{"$where", "this.a > 1"}}}, errUnsupportedWatchFilter},
+		{"$where in a $match stage", &querybuilder.Query{Aggregate: bson.A{bson.D{{"$match", bson.D{{"$where", "this.a > 1"}}}}}}, errUnsupportedWatchFilter},
+		{"group that is not an array", &querybuilder.Query{RawQuery: bson.D{{"$or", bson.D{{"a", 1}}}}}, errUnsupportedWatchFilter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := watchPipeline(tt.query, nil); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}